@@ -0,0 +1,113 @@
+package defaults
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sync"
+
+	"github.com/zzjcool/goutils/internal/reflectx"
+)
+
+// Defaulter is implemented by types that compute their own defaults. Apply
+// calls SetDefaults after the `default` tags of the value have been applied,
+// so it can fill in fields that depend on other fields.
+type Defaulter interface {
+	SetDefaults()
+}
+
+// Parser parses a default tag value into a value of the registered type.
+type Parser func(string) (any, error)
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = map[reflect.Type]Parser{}
+
+	defaulterType = reflect.TypeOf((*Defaulter)(nil)).Elem()
+)
+
+func init() {
+	RegisterParser(reflect.TypeOf(url.URL{}), func(s string) (any, error) {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		return *u, nil
+	})
+}
+
+// RegisterParser registers a parser for default values of type t, typically
+// for third-party types that don't implement encoding.TextUnmarshaler. The
+// parsed value must be assignable or convertible to t. Registered parsers take
+// precedence over every built-in parsing rule. It is meant to be called from
+// init functions, before Apply.
+func RegisterParser(t reflect.Type, parse Parser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	defer plans.Reset()
+	// The type is set from text as a whole, zconf and vtor don't walk into it
+	// either.
+	reflectx.RegisterText(t, parse != nil)
+	if parse == nil {
+		delete(parsers, t)
+		return
+	}
+	parsers[t] = parse
+}
+
+func lookupParser(t reflect.Type) (Parser, bool) {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	parse, ok := parsers[t]
+	return parse, ok
+}
+
+func isDefaulter(t reflect.Type) bool {
+	return reflect.PointerTo(t).Implements(defaulterType)
+}
+
+// callDefaulter calls SetDefaults if v is addressable and implements Defaulter.
+func callDefaulter(v reflect.Value) {
+	if !v.CanAddr() || !v.Addr().CanInterface() {
+		return
+	}
+	if d, ok := v.Addr().Interface().(Defaulter); ok {
+		d.SetDefaults()
+	}
+}
+
+// setCustom sets value through a registered parser or encoding.TextUnmarshaler.
+// It reports false if value's type has neither.
+func setCustom(value reflect.Value, tagVal string) (bool, error) {
+	if parse, ok := lookupParser(value.Type()); ok {
+		parsed, err := parse(tagVal)
+		if err != nil {
+			return true, err
+		}
+		rv := reflect.ValueOf(parsed)
+		switch {
+		case !rv.IsValid():
+			return true, fmt.Errorf("parser for %v returned nil", value.Type())
+		case rv.Type().AssignableTo(value.Type()):
+		case rv.Type().ConvertibleTo(value.Type()):
+			rv = rv.Convert(value.Type())
+		default:
+			return true, fmt.Errorf("parser for %v returned a %v", value.Type(), rv.Type())
+		}
+		value.Set(rv)
+		return true, nil
+	}
+
+	if reflect.PointerTo(value.Type()).Implements(reflectx.TextUnmarshalerType) {
+		// Unmarshal into a fresh value so a failed parse leaves the field
+		// untouched.
+		ptr := reflect.New(value.Type())
+		if err := ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(tagVal)); err != nil {
+			return true, err
+		}
+		value.Set(ptr.Elem())
+		return true, nil
+	}
+	return false, nil
+}
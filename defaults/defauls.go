@@ -18,9 +18,16 @@
 package defaults
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zzjcool/goutils/zoption"
+	"github.com/zzjcool/goutils/internal/reflectx"
 )
 
 // ErrNotAStructPointer indicates that we were expecting a pointer to a struct,
@@ -55,52 +62,91 @@ func (e ErrorUnsupportedType) Error() string {
 	return fmt.Sprintf("unsupported type %v", e.t)
 }
 
+// FieldError indicates that the default value of a field couldn't be applied.
+type FieldError struct {
+	// Path is the dotted path of the field from the root struct, e.g.
+	// Server.TLS.Port.
+	Path string
+	// Tag is the value of the field's `default` tag.
+	Tag string
+	// Err is the underlying parse error.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("field %s: default %q: %v", e.Path, e.Tag, e.Err)
+}
+
+// Unwrap returns the underlying parse error.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Option configures Apply.
+type Option = zoption.Option[*options]
+
+type options struct {
+	lookup LookupFunc // expands variables in tags when set
+}
+
 // Apply parses a struct pointer for `default` tags. If the default tag is
 // set and the struct member has a default value, the default value will be
 // set no the member. Parse expects a struct pointer.
-func Apply(t interface{}) error {
+//
+// Every field is processed even if some of them fail, the returned error joins
+// a *FieldError for each field whose default couldn't be applied.
+func Apply(t interface{}, opts ...Option) error {
+	_, err := run(t, applyMode, opts)
+	return err
+}
+
+// Parse parses s as a value of type t the same way default tags are parsed. It
+// can be used to read durations, slices and maps from other sources, such as
+// environment variables.
+func Parse(t reflect.Type, s string) (any, error) {
+	v := reflect.New(t).Elem()
+	if err := setValue(v, s); err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// run walks the struct pointer t in the given mode.
+func run(t interface{}, mode mode, opts []Option) (*applier, error) {
 	// Make sure we've been given a pointer.
 	val := reflect.ValueOf(t)
 	if val.Kind() != reflect.Ptr {
-		return newErrNotAStructPointer(t)
+		return nil, newErrNotAStructPointer(t)
 	}
 
 	// Make sure the pointer is pointing to a struct.
 	ref := val.Elem()
 	if ref.Kind() != reflect.Struct {
-		return newErrNotAStructPointer(t)
+		return nil, newErrNotAStructPointer(t)
 	}
 
-	return parseFields(ref)
-}
-
-func parseFields(v reflect.Value) error {
-	for i := 0; i < v.NumField(); i++ {
-		err := parseField(v.Field(i), v.Type().Field(i))
-		if err != nil {
-			return err
-		}
+	a := &applier{mode: mode}
+	if err := zoption.Build(&a.options, opts...); err != nil {
+		return nil, err
 	}
-	return nil
+	a.visited.Root(val)
+	a.applyStruct(ref, "")
+	return a, errors.Join(a.errs...)
 }
 
-func parseField(value reflect.Value, field reflect.StructField) error {
-	tagVal := field.Tag.Get("default")
-
-	isStruct := value.Kind() == reflect.Struct
-	isStructPointer := value.Kind() == reflect.Ptr && value.Type().Elem().Kind() == reflect.Struct
-
-	if (tagVal == "" || tagVal == "-") && !(isStruct || isStructPointer) {
-		return nil
+// setValue parses tagVal according to the type of value and sets it.
+func setValue(value reflect.Value, tagVal string) error {
+	if ok, err := setCustom(value, tagVal); ok {
+		return err
 	}
 
-	if !value.CanSet() {
-		return nil
-	}
-
-	if !value.IsZero() {
-		// A value is set on this field so there's no need to set a default
-		// value.
+	if value.Type() == reflectx.DurationType {
+		d, err := parseDuration(tagVal)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(d))
 		return nil
 	}
 
@@ -117,30 +163,6 @@ func parseField(value reflect.Value, field reflect.StructField) error {
 		value.SetBool(b)
 		return nil
 
-	case reflect.Int:
-		i, err := strconv.ParseInt(tagVal, 10, 32)
-		if err != nil {
-			return err
-		}
-		value.SetInt(i)
-		return nil
-
-	case reflect.Int8:
-		i, err := strconv.ParseInt(tagVal, 10, 8)
-		if err != nil {
-			return err
-		}
-		value.SetInt(i)
-		return nil
-
-	case reflect.Int16:
-		i, err := strconv.ParseInt(tagVal, 10, 16)
-		if err != nil {
-			return err
-		}
-		value.SetInt(i)
-		return nil
-
 	// NB: int32 is also an alias for a rune
 	case reflect.Int32:
 		i, err := parseInt32(tagVal)
@@ -150,246 +172,191 @@ func parseField(value reflect.Value, field reflect.StructField) error {
 		value.SetInt(int64(i))
 		return nil
 
-	case reflect.Int64:
-		i, err := strconv.ParseInt(tagVal, 10, 64)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int64:
+		i, err := strconv.ParseInt(tagVal, 0, value.Type().Bits())
 		if err != nil {
 			return err
 		}
 		value.SetInt(i)
 		return nil
 
-	case reflect.Uint:
-		i, err := strconv.ParseInt(tagVal, 10, 32)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(tagVal, 0, value.Type().Bits())
 		if err != nil {
 			return err
 		}
-		value.SetUint(uint64(i))
+		value.SetUint(u)
 		return nil
 
-	case reflect.Uint8:
-		i, err := strconv.ParseInt(tagVal, 10, 8)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(tagVal, value.Type().Bits())
 		if err != nil {
 			return err
 		}
-		value.SetUint(uint64(i))
+		value.SetFloat(f)
 		return nil
 
-	case reflect.Uint16:
-		i, err := strconv.ParseInt(tagVal, 10, 16)
-		if err != nil {
-			return err
+	case reflect.Slice:
+		// a []uint8 is a an alias for a []byte
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			value.SetBytes([]byte(tagVal))
+			return nil
 		}
-		value.SetUint(uint64(i))
-		return nil
+		return setSlice(value, tagVal)
 
-	case reflect.Uint32:
-		i, err := strconv.ParseInt(tagVal, 10, 32)
-		if err != nil {
+	case reflect.Map:
+		return setMap(value, tagVal)
+
+	case reflect.Ptr:
+		// Parse into a freshly allocated value so a failed parse leaves the
+		// field untouched.
+		ptr := reflect.New(value.Type().Elem())
+		if err := setValue(ptr.Elem(), tagVal); err != nil {
 			return err
 		}
-		value.SetUint(uint64(i))
+		value.Set(ptr)
 		return nil
 
-	case reflect.Uint64:
-		i, err := strconv.ParseInt(tagVal, 10, 64)
-		if err != nil {
+	default:
+		return ErrorUnsupportedType{value.Type()}
+	}
+}
+
+// setSlice parses either a JSON list (`[1, 2, 3]`) or a comma separated list
+// (`1,2,3`) into a slice.
+func setSlice(value reflect.Value, tagVal string) error {
+	items, err := splitList(tagVal)
+	if err != nil {
+		return err
+	}
+
+	slice := reflect.MakeSlice(value.Type(), len(items), len(items))
+	for i, item := range items {
+		if err := setValue(slice.Index(i), item); err != nil {
 			return err
 		}
-		value.SetUint(uint64(i))
-		return nil
+	}
+	value.Set(slice)
+	return nil
+}
 
-	case reflect.Float32:
-		f, err := strconv.ParseFloat(tagVal, 32)
-		if err != nil {
+// setMap parses either a JSON object (`{"a": 1}`) or a comma separated list
+// of key:value pairs (`a:1,b:2`) into a map.
+func setMap(value reflect.Value, tagVal string) error {
+	pairs, err := splitPairs(tagVal)
+	if err != nil {
+		return err
+	}
+
+	typ := value.Type()
+	m := reflect.MakeMapWithSize(typ, len(pairs))
+	for _, pair := range pairs {
+		k := reflect.New(typ.Key()).Elem()
+		if err := setValue(k, pair[0]); err != nil {
 			return err
 		}
-		value.SetFloat(f)
-		return nil
-
-	case reflect.Float64:
-		f, err := strconv.ParseFloat(tagVal, 64)
-		if err != nil {
+		v := reflect.New(typ.Elem()).Elem()
+		if err := setValue(v, pair[1]); err != nil {
 			return err
 		}
-		value.SetFloat(f)
-		return nil
-
-	case reflect.Slice:
-		switch value.Type().Elem().Kind() {
-		// a []uint8 is a an alias for a []byte
-		case reflect.Uint8:
-			value.SetBytes([]byte(tagVal))
-			return nil
+		m.SetMapIndex(k, v)
+	}
+	value.Set(m)
+	return nil
+}
 
-		default:
-			return ErrorUnsupportedType{value.Type()}
+func splitList(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "[") {
+		var raws []json.RawMessage
+		if err := json.Unmarshal([]byte(s), &raws); err != nil {
+			return nil, err
 		}
-
-	case reflect.Struct:
-		if value.NumField() == 0 {
-			return nil
+		items := make([]string, len(raws))
+		for i, raw := range raws {
+			items[i] = rawString(raw)
 		}
-		return parseFields(value) // recurse
-
-	case reflect.Ptr:
-		ref := value.Type().Elem()
-
-		switch ref.Kind() {
-		case reflect.String:
-			value.Set(reflect.ValueOf(&tagVal))
-			return nil
-
-		case reflect.Bool:
-			b, err := strconv.ParseBool(tagVal)
-			if err != nil {
-				return err
-			}
-			value.Set(reflect.ValueOf(&b))
-			return nil
-
-		case reflect.Int:
-			n, err := strconv.ParseInt(tagVal, 10, 32)
-			if err != nil {
-				return err
-			}
-			i := int(n)
-			value.Set(reflect.ValueOf(&i))
-			return nil
-
-		case reflect.Int8:
-			n, err := strconv.ParseInt(tagVal, 10, 8)
-			if err != nil {
-				return err
-			}
-			i := int8(n)
-			value.Set(reflect.ValueOf(&i))
-			return nil
-
-		case reflect.Int16:
-			n, err := strconv.ParseInt(tagVal, 10, 16)
-			if err != nil {
-				return err
-			}
-			i := int16(n)
-			value.Set(reflect.ValueOf(&i))
-			return nil
-
-		case reflect.Int32:
-			// NB: *int32 is an alias for a *rune
-			i, err := parseInt32(tagVal)
-			if err != nil {
-				return err
-			}
-			value.Set(reflect.ValueOf(&i))
-			return nil
-
-		case reflect.Int64:
-			i, err := strconv.ParseInt(tagVal, 10, 64)
-			if err != nil {
-				return err
-			}
-			value.Set(reflect.ValueOf(&i))
-			return nil
-
-		case reflect.Uint:
-			n, err := strconv.ParseInt(tagVal, 10, 32)
-			if err != nil {
-				return err
-			}
-			u := uint(n)
-			value.Set(reflect.ValueOf(&u))
-			return nil
-
-		case reflect.Uint8:
-			n, err := strconv.ParseInt(tagVal, 10, 8)
-			if err != nil {
-				return err
-			}
-			u := uint8(n)
-			value.Set(reflect.ValueOf(&u))
-			return nil
+		return items, nil
+	}
 
-		case reflect.Uint16:
-			n, err := strconv.ParseInt(tagVal, 10, 16)
-			if err != nil {
-				return err
-			}
-			u := uint16(n)
-			value.Set(reflect.ValueOf(&u))
-			return nil
+	items := strings.Split(s, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items, nil
+}
 
-		case reflect.Uint32:
-			n, err := strconv.ParseInt(tagVal, 10, 32)
-			if err != nil {
-				return err
-			}
-			u := uint32(n)
-			value.Set(reflect.ValueOf(&u))
-			return nil
+func splitPairs(s string) ([][2]string, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "{") {
+		var raws map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(s), &raws); err != nil {
+			return nil, err
+		}
+		pairs := make([][2]string, 0, len(raws))
+		for k, raw := range raws {
+			pairs = append(pairs, [2]string{k, rawString(raw)})
+		}
+		return pairs, nil
+	}
 
-		case reflect.Uint64:
-			n, err := strconv.ParseInt(tagVal, 10, 64)
-			if err != nil {
-				return err
-			}
-			u := uint64(n)
-			value.Set(reflect.ValueOf(&u))
-			return nil
+	var pairs [][2]string
+	for _, item := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid map item %q, expected key:value", item)
+		}
+		pairs = append(pairs, [2]string{strings.TrimSpace(k), strings.TrimSpace(v)})
+	}
+	return pairs, nil
+}
 
-		case reflect.Float32:
-			f, err := strconv.ParseFloat(tagVal, 32)
-			if err != nil {
-				return err
-			}
-			f32 := float32(f)
-			value.Set(reflect.ValueOf(&f32))
-			return nil
+// rawString unquotes JSON strings and returns any other JSON value as is, so
+// that both `["1s"]` and `[1]` can be parsed by setValue.
+func rawString(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
 
-		case reflect.Float64:
-			f, err := strconv.ParseFloat(tagVal, 64)
-			if err != nil {
-				return err
-			}
-			value.Set(reflect.ValueOf(&f))
-			return nil
+// parseDuration is time.ParseDuration with additional support for a leading
+// day unit, e.g. `7d` or `1d12h`.
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err == nil {
+		return d, nil
+	}
 
-		case reflect.Slice:
-			switch ref.Elem().Kind() {
-			// a *[]uint is an alias for *[]byte
-			case reflect.Uint8:
-				b := []byte(tagVal)
-				value.Set(reflect.ValueOf(&b))
-				return nil
-
-			default:
-				return ErrorUnsupportedType{value.Type()}
-			}
-
-		case reflect.Struct:
-			if ref.NumField() == 0 {
-				return nil
-			}
-
-			// If it's nil set it to it's default value so we can set the
-			// children if we need to.
-			if value.IsNil() {
-				value.Set(reflect.New(ref))
-			}
-			return parseFields(value.Elem()) // recurse
-
-		default:
-			return ErrorUnsupportedType{value.Type()}
+	sign := time.Duration(1)
+	rest := s
+	if strings.HasPrefix(rest, "-") {
+		sign, rest = -1, rest[1:]
+	}
+	days, rest, ok := strings.Cut(rest, "d")
+	if !ok {
+		return 0, err
+	}
+	n, perr := strconv.ParseFloat(days, 64)
+	if perr != nil {
+		return 0, err
+	}
+	d = time.Duration(n * float64(24*time.Hour))
+	if rest != "" {
+		r, rerr := time.ParseDuration(rest)
+		if rerr != nil {
+			return 0, err
 		}
-
-	default:
-		return ErrorUnsupportedType{value.Type()}
+		d += r
 	}
+	return sign * d, nil
 }
 
 // Attempt to parse a string as an int32 and, failing that, a rune.
 func parseInt32(s string) (int32, error) {
 	// Try parsing it as an int.
-	i, err := strconv.ParseInt(s, 10, 32)
+	i, err := strconv.ParseInt(s, 0, 32)
 	if err == nil {
 		return int32(i), nil
 	}
@@ -2,7 +2,17 @@ package defaults
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestOnlyAcceptStructPointers(t *testing.T) {
@@ -212,3 +222,587 @@ func TestSetDefaults(t *testing.T) {
 		err(t, "string in embedded struct", s, test.EmbeddedPtr.String)
 	}
 }
+
+func TestSetCollectionAndTimeDefaults(t *testing.T) {
+	test := struct {
+		Strings     []string          `default:"a, b,c"`
+		Ints        []int             `default:"[1, 2, 3]"`
+		StringsJSON []string          `default:"[\"a,b\", \"c\"]"`
+		Durations   []time.Duration   `default:"1s,2m"`
+		IntsPtr     *[]int            `default:"1,2"`
+		Map         map[string]int    `default:"a:1, b:2"`
+		MapJSON     map[string]string `default:"{\"a\": \"x:y\"}"`
+		MapPtr      *map[int]bool     `default:"1:true"`
+
+		Duration    time.Duration  `default:"1h30m"`
+		DurationDay time.Duration  `default:"7d"`
+		DurationPtr *time.Duration `default:"1d12h"`
+		Time        time.Time      `default:"2024-01-02T03:04:05Z"`
+		TimePtr     *time.Time     `default:"2024-01-02T03:04:05+08:00"`
+	}{}
+
+	if err := Apply(&test); err != nil {
+		t.Fatalf("could not parse struct tags: %v", err)
+	}
+
+	check := func(name string, expected, actual interface{}) {
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("%s: expected '%v', got '%v'", name, expected, actual)
+		}
+	}
+
+	check("string slice", []string{"a", "b", "c"}, test.Strings)
+	check("int slice", []int{1, 2, 3}, test.Ints)
+	check("json string slice", []string{"a,b", "c"}, test.StringsJSON)
+	check("duration slice", []time.Duration{time.Second, 2 * time.Minute}, test.Durations)
+	check("int slice pointer", []int{1, 2}, *test.IntsPtr)
+	check("map", map[string]int{"a": 1, "b": 2}, test.Map)
+	check("json map", map[string]string{"a": "x:y"}, test.MapJSON)
+	check("map pointer", map[int]bool{1: true}, *test.MapPtr)
+
+	check("duration", 90*time.Minute, test.Duration)
+	check("duration in days", 7*24*time.Hour, test.DurationDay)
+	check("duration pointer", 36*time.Hour, *test.DurationPtr)
+	check("time", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), test.Time)
+	if !test.TimePtr.Equal(time.Date(2024, 1, 1, 19, 4, 5, 0, time.UTC)) {
+		t.Errorf("time pointer: got '%v'", test.TimePtr)
+	}
+}
+
+func TestSetInvalidCollectionDefaults(t *testing.T) {
+	for name, v := range map[string]interface{}{
+		"slice": &struct {
+			A []int `default:"1,x"`
+		}{},
+		"map": &struct {
+			A map[string]int `default:"a"`
+		}{},
+		"duration": &struct {
+			A time.Duration `default:"1x"`
+		}{},
+		"time": &struct {
+			A time.Time `default:"yesterday"`
+		}{},
+	} {
+		if err := Apply(v); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "debug":
+		*l = 1
+	case "info":
+		*l = 2
+	default:
+		return fmt.Errorf("unknown level %q", text)
+	}
+	return nil
+}
+
+type celsius float64
+
+type server struct {
+	Host string `default:"localhost"`
+	Port int    `default:"80"`
+	Addr string
+}
+
+func (s *server) SetDefaults() {
+	if s.Addr == "" {
+		s.Addr = fmt.Sprintf("%s:%d", s.Host, s.Port)
+	}
+}
+
+func TestSetCustomDefaults(t *testing.T) {
+	RegisterParser(reflect.TypeOf(celsius(0)), func(s string) (any, error) {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(s, "C"), 64)
+		return f, err
+	})
+	defer RegisterParser(reflect.TypeOf(celsius(0)), nil)
+
+	test := struct {
+		IP       net.IP   `default:"127.0.0.1"`
+		URL      url.URL  `default:"https://example.com/path"`
+		URLPtr   *url.URL `default:"https://example.com"`
+		Level    level    `default:"info"`
+		LevelPtr *level   `default:"debug"`
+		Temp     celsius  `default:"21.5C"`
+		Server   server
+	}{}
+
+	if err := Apply(&test); err != nil {
+		t.Fatalf("could not parse struct tags: %v", err)
+	}
+
+	if !test.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("ip: got '%v'", test.IP)
+	}
+	if test.URL.Host != "example.com" || test.URL.Path != "/path" {
+		t.Errorf("url: got '%v'", test.URL.String())
+	}
+	if test.URLPtr.Host != "example.com" {
+		t.Errorf("url pointer: got '%v'", test.URLPtr)
+	}
+	if test.Level != 2 || *test.LevelPtr != 1 {
+		t.Errorf("text unmarshaler: got '%v' and '%v'", test.Level, *test.LevelPtr)
+	}
+	if test.Temp != 21.5 {
+		t.Errorf("registered parser: got '%v'", test.Temp)
+	}
+	if test.Server.Addr != "localhost:80" {
+		t.Errorf("defaulter: got '%v'", test.Server.Addr)
+	}
+
+	invalid := struct {
+		Level level `default:"trace"`
+	}{}
+	if err := Apply(&invalid); err == nil {
+		t.Error("expected an error from UnmarshalText")
+	}
+}
+
+func TestSetNumericDefaults(t *testing.T) {
+	test := struct {
+		Int       int     `default:"3000000000"`
+		Hex       int     `default:"0xff"`
+		Octal     uint32  `default:"0o755"`
+		Binary    uint8   `default:"0b1010"`
+		Separated int64   `default:"1_000_000"`
+		Uint      uint    `default:"4294967296"`
+		Uint64    uint64  `default:"18446744073709551615"`
+		Uint64Ptr *uint64 `default:"0xffffffffffffffff"`
+		Negative  int8    `default:"-128"`
+		Float32   float32 `default:"1.5"`
+	}{}
+
+	if err := Apply(&test); err != nil {
+		t.Fatalf("could not parse struct tags: %v", err)
+	}
+
+	if strconv.IntSize == 64 && test.Int != 3000000000 {
+		t.Errorf("int: got '%v'", test.Int)
+	}
+	if test.Hex != 255 || test.Octal != 0755 || test.Binary != 10 || test.Separated != 1000000 {
+		t.Errorf("literals: got '%v', '%v', '%v', '%v'", test.Hex, test.Octal, test.Binary, test.Separated)
+	}
+	if strconv.IntSize == 64 && test.Uint != 4294967296 {
+		t.Errorf("uint: got '%v'", test.Uint)
+	}
+	if test.Uint64 != math.MaxUint64 || *test.Uint64Ptr != math.MaxUint64 {
+		t.Errorf("uint64: got '%v' and '%v'", test.Uint64, *test.Uint64Ptr)
+	}
+	if test.Negative != -128 || test.Float32 != 1.5 {
+		t.Errorf("got '%v' and '%v'", test.Negative, test.Float32)
+	}
+}
+
+func TestFieldErrors(t *testing.T) {
+	test := struct {
+		Server struct {
+			TLS *struct {
+				Port uint16 `default:"70000"`
+			}
+			Name string `default:"ok"`
+		}
+		Debug  bool `default:"maybe"`
+		Weight []int
+	}{}
+
+	err := Apply(&test)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	var paths []string
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var fe *FieldError
+		if !errors.As(e, &fe) {
+			t.Fatalf("expected a *FieldError, got %T", e)
+		}
+		paths = append(paths, fe.Path)
+	}
+	if !reflect.DeepEqual(paths, []string{"Server.TLS.Port", "Debug"}) {
+		t.Errorf("unexpected error paths %v", paths)
+	}
+
+	var fe *FieldError
+	if errors.As(err, &fe); fe.Tag != "70000" || !errors.Is(err, strconv.ErrRange) {
+		t.Errorf("unexpected field error %v", fe)
+	}
+	if test.Server.Name != "ok" {
+		t.Errorf("fields after a failing one should still be set")
+	}
+}
+
+func TestExpandDefaults(t *testing.T) {
+	env := map[string]string{"HOME": "/home/goku", "PORT": "9000", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	test := struct {
+		Dir      string `default:"${HOME}/logs"`
+		Port     int    `default:"${PORT:-8080}"`
+		Fallback int    `default:"${NOPE:-${PORT}}"`
+		Empty    string `default:"${EMPTY-unset}"`
+		EmptyDef string `default:"${EMPTY:-unset}"`
+		Price    string `default:"$$5 or $$${PORT}"`
+		Optional *int   `default:"${NOPE:-}"`
+	}{}
+
+	if err := Apply(&test, WithExpand(lookup)); err != nil {
+		t.Fatalf("could not parse struct tags: %v", err)
+	}
+
+	check := func(name string, expected, actual interface{}) {
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("%s: expected '%v', got '%v'", name, expected, actual)
+		}
+	}
+	check("variable", "/home/goku/logs", test.Dir)
+	check("variable with default", 9000, test.Port)
+	check("nested default", 9000, test.Fallback)
+	check("set but empty", "", test.Empty)
+	check("empty with default", "unset", test.EmptyDef)
+	check("escaped", "$5 or $9000", test.Price)
+	if test.Optional != nil {
+		t.Errorf("empty expansion should leave the field unset")
+	}
+
+	raw := struct {
+		Dir string `default:"${HOME}/logs"`
+	}{}
+	if err := Apply(&raw); err != nil || raw.Dir != "${HOME}/logs" {
+		t.Errorf("expansion should be opt-in, got '%v' (%v)", raw.Dir, err)
+	}
+}
+
+func TestExpandErrors(t *testing.T) {
+	lookup := func(string) (string, bool) { return "", false }
+	for tag, v := range map[string]interface{}{
+		"${NOPE}": &struct {
+			A string `default:"${NOPE}"`
+		}{},
+		"${NOPE?required}": &struct {
+			A string `default:"${NOPE?required}"`
+		}{},
+		"${NOPE:?}": &struct {
+			A string `default:"${NOPE:?}"`
+		}{},
+	} {
+		err := Apply(v, WithExpand(lookup))
+		if !errors.Is(err, ErrUnresolvedVariable) {
+			t.Errorf("%s: expected ErrUnresolvedVariable, got %v", tag, err)
+		}
+	}
+
+	for tag, v := range map[string]interface{}{
+		"${NOPE": &struct {
+			A string `default:"${NOPE"`
+		}{},
+		"${!}": &struct {
+			A string `default:"${!}"`
+		}{},
+		"${A+b}": &struct {
+			A string `default:"${A+b}"`
+		}{},
+	} {
+		if err := Apply(v, WithExpand(lookup)); err == nil {
+			t.Errorf("%s: expected a syntax error", tag)
+		}
+	}
+}
+
+func TestPlanDoesNotShareValues(t *testing.T) {
+	type config struct {
+		Hosts []string       `default:"a,b"`
+		Ports map[string]int `default:"a:1"`
+		Port  *int           `default:"80"`
+	}
+
+	var a, b config
+	if err := Apply(&a); err != nil {
+		t.Fatal(err)
+	}
+	a.Hosts[0], a.Ports["a"], *a.Port = "changed", 2, 8080
+
+	if err := Apply(&b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Hosts[0] != "a" || b.Ports["a"] != 1 || *b.Port != 80 {
+		t.Errorf("defaults are shared between structs: %v %v %v", b.Hosts, b.Ports, *b.Port)
+	}
+}
+
+func TestPlanDoesNotShareStructValues(t *testing.T) {
+	type config struct {
+		N     big.Int    `default:"5"`
+		P     *big.Int   `default:"5"`
+		Nums  []*big.Int `default:"1,2"`
+		Proxy url.URL    `default:"http://user@proxy"`
+	}
+
+	var a, b config
+	if err := Apply(&a); err != nil {
+		t.Fatal(err)
+	}
+	a.N.SetInt64(7)
+	a.P.SetInt64(7)
+	a.Nums[0].SetInt64(7)
+	*a.Proxy.User = *url.User("changed")
+
+	if err := Apply(&b); err != nil {
+		t.Fatal(err)
+	}
+	if b.N.Int64() != 5 || b.P.Int64() != 5 || b.Nums[0].Int64() != 1 || b.Proxy.User.Username() != "user" {
+		t.Errorf("defaults are shared between structs: %v %v %v %v", &b.N, b.P, b.Nums, b.Proxy.User)
+	}
+}
+
+type benchConfig struct {
+	Name    string        `default:"httpserver"`
+	Port    uint          `default:"12321"`
+	Debug   bool          `default:"true"`
+	Ratio   float64       `default:"0.75"`
+	Timeout time.Duration `default:"30s"`
+	Hosts   []string      `default:"a.example.com,b.example.com"`
+	TLS     struct {
+		Cert string `default:"cert.pem"`
+		Key  string `default:"key.pem"`
+	}
+	Limits *struct {
+		Rate  int `default:"100"`
+		Burst int `default:"200"`
+	}
+}
+
+func BenchmarkApply(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		var c benchConfig
+		if err := Apply(&c); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkApplyUncached(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		plans.Reset()
+		var c benchConfig
+		if err := Apply(&c); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type backend struct {
+	Host   string `default:"localhost"`
+	Weight int    `default:"1"`
+}
+
+type base struct {
+	Name string `default:"base"`
+}
+
+type node struct {
+	Name string `default:"node"`
+	Next *node
+}
+
+func TestSetElementDefaults(t *testing.T) {
+	test := struct {
+		base
+		Servers  []backend
+		Ptrs     []*backend
+		Array    [2]backend
+		Backends map[string]*backend
+		Values   map[string]backend
+		Nested   [][]backend
+		Nil      *backend
+		Server   backend
+		Hosts    []backend `default:"-"`
+	}{
+		Servers:  []backend{{Host: "a"}, {Weight: 2}},
+		Ptrs:     []*backend{{Host: "b"}, nil},
+		Backends: map[string]*backend{"x": {Host: "x"}},
+		Values:   map[string]backend{"y": {Weight: 3}},
+		Nested:   [][]backend{{{Host: "z"}}},
+		Server:   backend{Host: "s"},
+	}
+
+	if err := Apply(&test); err != nil {
+		t.Fatalf("could not parse struct tags: %v", err)
+	}
+
+	check := func(name string, expected, actual interface{}) {
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("%s: expected '%v', got '%v'", name, expected, actual)
+		}
+	}
+	check("embedded", "base", test.Name)
+	check("slice", []backend{{"a", 1}, {"localhost", 2}}, test.Servers)
+	check("slice of pointers", backend{"b", 1}, *test.Ptrs[0])
+	check("nil element", (*backend)(nil), test.Ptrs[1])
+	check("array", [2]backend{{"localhost", 1}, {"localhost", 1}}, test.Array)
+	check("map of pointers", backend{"x", 1}, *test.Backends["x"])
+	check("map of values", backend{"localhost", 3}, test.Values["y"])
+	check("nested slice", backend{"z", 1}, test.Nested[0][0])
+	check("nil pointer", backend{"localhost", 1}, *test.Nil)
+	check("partially set struct", backend{"s", 1}, test.Server)
+}
+
+func TestElementErrorPaths(t *testing.T) {
+	type item struct {
+		Port uint8 `default:"300"`
+	}
+	test := struct {
+		Items []item
+		Map   map[string]item
+	}{
+		Items: []item{{Port: 1}, {}},
+		Map:   map[string]item{"a": {}},
+	}
+
+	err := Apply(&test)
+	var paths []string
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		paths = append(paths, e.(*FieldError).Path)
+	}
+	if !reflect.DeepEqual(paths, []string{"Items[1].Port", "Map[a].Port"}) {
+		t.Errorf("unexpected error paths %v", paths)
+	}
+}
+
+func TestPointerCycles(t *testing.T) {
+	var n node
+	if err := Apply(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Name != "node" || n.Next != nil {
+		t.Errorf("recursive types should not be allocated, got %+v", n)
+	}
+
+	a := &node{Next: &node{}}
+	a.Next.Next = a
+	if err := Apply(a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Name != "node" || a.Next.Name != "node" {
+		t.Errorf("cyclic values should be applied once, got %+v", a)
+	}
+}
+
+func TestKeepNilPointers(t *testing.T) {
+	type config struct {
+		TLS *backend `default:"-"`
+		Set *backend `default:"-"`
+	}
+
+	c := config{Set: &backend{}}
+	if err := Apply(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.TLS != nil {
+		t.Errorf("expected nil pointer to be kept, got %+v", c.TLS)
+	}
+	if *c.Set != (backend{"localhost", 1}) {
+		t.Errorf("expected set pointer to be walked, got %+v", c.Set)
+	}
+}
+
+type resetConfig struct {
+	Name    string `default:"app"`
+	Port    int    `default:"8080"`
+	Comment string
+	Servers []backend
+	TLS     *struct {
+		Cert string `default:"cert.pem"`
+	}
+}
+
+func TestReset(t *testing.T) {
+	c := resetConfig{
+		Name:    "custom",
+		Port:    9000,
+		Comment: "kept",
+		Servers: []backend{{Host: "a", Weight: 5}},
+	}
+	if err := Reset(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "app" || c.Port != 8080 || c.Comment != "kept" {
+		t.Errorf("unexpected reset result %+v", c)
+	}
+	if !reflect.DeepEqual(c.Servers, []backend{{"localhost", 1}}) || c.TLS.Cert != "cert.pem" {
+		t.Errorf("nested fields should be reset too, got %+v %+v", c.Servers, c.TLS)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	c := resetConfig{
+		Name:    "custom",
+		Servers: []backend{{Host: "localhost", Weight: 5}},
+	}
+	diffs, err := Diff(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Difference{
+		{Path: "Name", Default: "app", Value: "custom"},
+		{Path: "Port", Default: 8080, Value: 0},
+		{Path: "Servers[0].Weight", Default: 1, Value: 5},
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("expected %+v, got %+v", expected, diffs)
+	}
+	if c.TLS != nil {
+		t.Errorf("Diff should not modify the struct")
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	var paths []string
+	for _, d := range Describe(reflect.TypeOf(&resetConfig{})) {
+		paths = append(paths, fmt.Sprintf("%s %v %q", d.Path, d.Type, d.Default))
+	}
+	expected := []string{
+		`Name string "app"`,
+		`Port int "8080"`,
+		`Comment string ""`,
+		`Servers []defaults.backend ""`,
+		`Servers[].Host string "localhost"`,
+		`Servers[].Weight int "1"`,
+		`TLS *struct { Cert string "default:\"cert.pem\"" } ""`,
+		`TLS.Cert string "cert.pem"`,
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %q, got %q", expected, paths)
+	}
+
+	if d := Describe(reflect.TypeOf(node{})); len(d) != 2 {
+		t.Errorf("recursive types should be described once, got %+v", d)
+	}
+	if Describe(reflect.TypeOf(1)) != nil {
+		t.Errorf("non-struct types should not be described")
+	}
+}
+
+func TestParse(t *testing.T) {
+	v, err := Parse(reflect.TypeOf([]time.Duration{}), "1s,2d")
+	if err != nil || !reflect.DeepEqual(v, []time.Duration{time.Second, 48 * time.Hour}) {
+		t.Errorf("unexpected %v, %v", v, err)
+	}
+	v, err = Parse(reflect.TypeOf(map[string]int{}), "a:1")
+	if err != nil || !reflect.DeepEqual(v, map[string]int{"a": 1}) {
+		t.Errorf("unexpected %v, %v", v, err)
+	}
+	if _, err := Parse(reflect.TypeOf(0), "x"); err == nil {
+		t.Errorf("expected an error parsing an invalid int")
+	}
+}
@@ -0,0 +1,108 @@
+package defaults
+
+import (
+	"reflect"
+
+	"github.com/zzjcool/goutils/internal/reflectx"
+)
+
+// Reset parses a struct pointer for `default` tags like Apply, but sets every
+// field with a default tag to its default value, whether it is at its zero
+// value or not. Fields without a default tag are left as they are.
+func Reset(t interface{}, opts ...Option) error {
+	_, err := run(t, resetMode, opts)
+	return err
+}
+
+// Difference is a field whose value differs from its default value.
+type Difference struct {
+	// Path is the dotted path of the field from the root struct.
+	Path string
+	// Default is the parsed default value of the field.
+	Default any
+	// Value is the current value of the field.
+	Value any
+}
+
+// Diff lists the fields of a struct pointer whose value differs from their
+// default tag. Fields without a default tag are never listed. The struct isn't
+// modified.
+func Diff(t interface{}, opts ...Option) ([]Difference, error) {
+	a, err := run(t, diffMode, opts)
+	if a == nil {
+		return nil, err
+	}
+	return a.diffs, err
+}
+
+// Description describes a field of a struct type.
+type Description struct {
+	// Path is the dotted path of the field from the root struct, elements of
+	// slices, arrays and maps are written as Servers[].Port.
+	Path string
+	// Type is the type of the field.
+	Type reflect.Type
+	// Default is the value of the field's `default` tag.
+	Default string
+	// Field is the struct field, e.g. to read its other tags.
+	Field reflect.StructField
+}
+
+// Describe lists the fields of a struct type, or a pointer to one, along with
+// their default tags. Structs are listed before their fields and walked the
+// same way Apply does. It returns nil for other types.
+//
+// It can be used to document a config struct or generate a sample config file.
+func Describe(t reflect.Type) []Description {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var descs []Description
+	describe(t, "", []reflect.Type{t}, &descs)
+	return descs
+}
+
+func describe(t reflect.Type, path string, stack []reflect.Type, descs *[]Description) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		desc := Description{
+			Path:  reflectx.JoinPath(path, field.Name),
+			Type:  field.Type,
+			Field: field,
+		}
+		if tag := field.Tag.Get("default"); tag != "-" {
+			desc.Default = tag
+		}
+
+		// Find the struct the field holds, if any.
+		elem, elemPath := field.Type, desc.Path
+	deref:
+		for {
+			switch elem.Kind() {
+			case reflect.Ptr:
+				elem = elem.Elem()
+			case reflect.Slice, reflect.Array, reflect.Map:
+				elem, elemPath = elem.Elem(), elemPath+"[]"
+			default:
+				break deref
+			}
+		}
+		isStruct := elem.Kind() == reflect.Struct && !reflectx.IsText(elem)
+
+		if !field.IsExported() && !isStruct {
+			continue
+		}
+		*descs = append(*descs, desc)
+
+		if isStruct && !reflectx.OnStack(stack, elem) {
+			describe(elem, elemPath, append(stack, elem), descs) // recurse
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package defaults
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zzjcool/goutils/zoption"
+)
+
+// ErrUnresolvedVariable indicates that a variable referenced by a default tag
+// is required but not set.
+var ErrUnresolvedVariable = errors.New("unresolved variable")
+
+// LookupFunc looks up the value of a variable, reporting whether it is set.
+// os.LookupEnv is a LookupFunc.
+type LookupFunc func(name string) (string, bool)
+
+// WithExpand expands variables in default tags through lookup before they are
+// parsed. The following forms are supported:
+//
+//	${VAR}          value of VAR, error if VAR is not set
+//	${VAR:-default} default if VAR is not set or empty
+//	${VAR-default}  default if VAR is not set
+//	${VAR:?message} error with message if VAR is not set or empty
+//	${VAR?message}  error with message if VAR is not set
+//	$$              a literal $
+//
+// Defaults may contain variables themselves, e.g. ${PORT:-${DEFAULT_PORT}}.
+// A tag that expands to an empty string is treated as having no default.
+func WithExpand(lookup LookupFunc) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		if lookup == nil {
+			return errors.New("defaults: nil lookup function")
+		}
+		o.lookup = lookup
+		return nil
+	})
+}
+
+// WithExpandEnv expands variables in default tags from the environment.
+func WithExpandEnv() Option {
+	return WithExpand(os.LookupEnv)
+}
+
+func expand(s string, lookup LookupFunc) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := closingBrace(s, i+1)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable in %q", s)
+			}
+			v, err := expandVar(s[i+2:end], lookup)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(v)
+			i = end
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// closingBrace returns the index of the brace closing the one at open, or -1.
+func closingBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func expandVar(expr string, lookup LookupFunc) (string, error) {
+	n := 0
+	for n < len(expr) && isNameByte(expr[n]) {
+		n++
+	}
+	name, op := expr[:n], expr[n:]
+	if name == "" {
+		return "", fmt.Errorf("invalid variable ${%s}", expr)
+	}
+
+	val, ok := lookup(name)
+	switch {
+	case op == "":
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrUnresolvedVariable, name)
+		}
+		return val, nil
+
+	case strings.HasPrefix(op, ":-"):
+		if !ok || val == "" {
+			return expand(op[2:], lookup)
+		}
+		return val, nil
+
+	case strings.HasPrefix(op, "-"):
+		if !ok {
+			return expand(op[1:], lookup)
+		}
+		return val, nil
+
+	case strings.HasPrefix(op, ":?"):
+		if !ok || val == "" {
+			return "", unresolved(name, op[2:])
+		}
+		return val, nil
+
+	case strings.HasPrefix(op, "?"):
+		if !ok {
+			return "", unresolved(name, op[1:])
+		}
+		return val, nil
+
+	default:
+		return "", fmt.Errorf("invalid variable ${%s}", expr)
+	}
+}
+
+func unresolved(name, msg string) error {
+	if msg == "" {
+		return fmt.Errorf("%w: %s", ErrUnresolvedVariable, name)
+	}
+	return fmt.Errorf("%w: %s: %s", ErrUnresolvedVariable, name, msg)
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
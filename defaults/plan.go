@@ -0,0 +1,218 @@
+package defaults
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/zzjcool/goutils/internal/reflectx"
+)
+
+// plans caches a *plan per struct type, so that tags are read and default
+// values are parsed once per type instead of on every Apply.
+var plans = reflectx.NewCache(compile)
+
+// plan is the compiled form of a struct type.
+type plan struct {
+	fields    []fieldPlan
+	defaulter bool // *T implements Defaulter
+}
+
+type fieldKind int
+
+const (
+	leafField      fieldKind = iota // set from the default tag
+	structField                     // recurse into the struct
+	structPtrField                  // allocate if nil, recurse into the struct
+	elemsField                      // set from the default tag, recurse into the elements
+)
+
+type fieldPlan struct {
+	index int
+	name  string
+	kind  fieldKind
+
+	// embedded is set for unexported embedded structs, whose exported fields
+	// can be set but which can't be allocated themselves.
+	embedded bool
+	// keepNil is set for struct pointers tagged default:"-", which are only
+	// walked when they are already set.
+	keepNil bool
+
+	tag       string        // default tag, empty if there is none
+	dynamic   bool          // tag contains variables to expand
+	value     reflect.Value // pre-parsed tag, valid if err is nil
+	err       error         // error from parsing the tag
+	reparse   bool          // value holds structs, parse the tag on every use
+	defaulter bool          // *T implements Defaulter
+}
+
+func compile(t reflect.Type) *plan {
+	p := &plan{defaulter: isDefaulter(t)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// Unexported fields can't be set, except for the exported fields of
+		// unexported embedded structs.
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		f := fieldPlan{
+			index:     i,
+			name:      field.Name,
+			embedded:  !field.IsExported(),
+			defaulter: isDefaulter(field.Type),
+		}
+		tag := field.Tag.Get("default")
+		if tag != "-" {
+			f.tag = tag
+		}
+
+		switch ft := field.Type; {
+		case ft.Kind() == reflect.Struct && !reflectx.IsText(ft):
+			if ft.NumField() == 0 {
+				continue
+			}
+			f.kind = structField
+
+		case ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct && !reflectx.IsText(ft.Elem()):
+			if ft.Elem().NumField() == 0 {
+				continue
+			}
+			f.kind = structPtrField
+			f.keepNil = tag == "-"
+
+		case f.embedded:
+			continue
+
+		case holdsStructs(ft):
+			f.kind = elemsField
+			f.parseTag(ft)
+
+		case f.tag != "" || f.defaulter:
+			f.kind = leafField
+			f.parseTag(ft)
+
+		default:
+			continue
+		}
+		p.fields = append(p.fields, f)
+	}
+	return p
+}
+
+func (f *fieldPlan) parseTag(t reflect.Type) {
+	if f.tag == "" {
+		return
+	}
+	f.dynamic = strings.Contains(f.tag, "$")
+	f.reparse = holdsStructValues(t)
+	f.value = reflect.New(t).Elem()
+	f.err = setValue(f.value, f.tag)
+}
+
+// holdsStructValues reports whether values of t contain structs other than
+// time.Time, possibly through pointers or collections. Their unexported
+// fields can't be copied, so clone can't separate them from the plan.
+func holdsStructValues(t reflect.Type) bool {
+	for seen := map[reflect.Type]bool{}; !seen[t]; {
+		seen[t] = true
+		switch t.Kind() {
+		case reflect.Struct:
+			return t != reflectx.TimeType
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			if t.Kind() == reflect.Map && holdsStructValues(t.Key()) {
+				return true
+			}
+			t = t.Elem()
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// holdsStructs reports whether t is a slice, array or map whose elements are
+// structs to recurse into, possibly through pointers or further collections.
+func holdsStructs(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+	default:
+		return false
+	}
+	for seen := map[reflect.Type]bool{}; !seen[t]; {
+		seen[t] = true
+		t = t.Elem()
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			continue
+		case reflect.Struct:
+			return !reflectx.IsText(t) && t.NumField() > 0
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// clone deep copies the pointers, slices, maps and arrays of a pre-parsed
+// value so that structs don't share them. Structs are copied shallowly, values
+// holding them are parsed again instead, see holdsStructValues.
+func clone(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(clone(v.Elem()))
+		return c
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(c, v)
+		if needsClone(v.Type().Elem()) {
+			for i := 0; i < v.Len(); i++ {
+				c.Index(i).Set(clone(v.Index(i)))
+			}
+		}
+		return c
+
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		reflect.Copy(c, v)
+		if needsClone(v.Type().Elem()) {
+			for i := 0; i < v.Len(); i++ {
+				c.Index(i).Set(clone(v.Index(i)))
+			}
+		}
+		return c
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(clone(iter.Key()), clone(iter.Value()))
+		}
+		return c
+
+	default:
+		return v
+	}
+}
+
+func needsClone(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		return true
+	case reflect.Array:
+		return needsClone(t.Elem())
+	default:
+		return false
+	}
+}
@@ -0,0 +1,196 @@
+package defaults
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/zzjcool/goutils/internal/reflectx"
+)
+
+// mode selects what an applier does with the default values.
+type mode int
+
+const (
+	applyMode mode = iota // set zero fields to their default
+	resetMode             // set every field to its default
+	diffMode              // collect fields differing from their default
+)
+
+// applier holds the state of a single Apply, Reset or Diff call.
+type applier struct {
+	options
+	mode  mode
+	errs  []error
+	diffs []Difference
+
+	// visited holds the pointers, slices and maps already walked, so that
+	// cyclic values are walked once.
+	visited reflectx.Visited
+	// stack holds the struct types being applied, nil pointers to them are
+	// not allocated to avoid recursing forever on recursive types.
+	stack []reflect.Type
+}
+
+// applyStruct applies the compiled plan of v's type to v, path is the dotted
+// path of v used in errors.
+func (a *applier) applyStruct(v reflect.Value, path string) {
+	p := plans.Get(v.Type())
+	a.stack = append(a.stack, v.Type())
+	defer func() { a.stack = a.stack[:len(a.stack)-1] }()
+
+	for i := range p.fields {
+		f := &p.fields[i]
+		value := v.Field(f.index)
+
+		switch f.kind {
+		case structField:
+			a.applyStruct(value, reflectx.JoinPath(path, f.name)) // recurse
+
+		case structPtrField:
+			if value.IsNil() {
+				// If it's nil set it to it's default value so we can set the
+				// children if we need to. Unexported embedded pointers can't
+				// be set, recursive types would never end and default:"-"
+				// asks to keep it nil.
+				if a.mode == diffMode || f.embedded || f.keepNil || reflectx.OnStack(a.stack, value.Type().Elem()) {
+					continue
+				}
+				value.Set(reflect.New(value.Type().Elem()))
+			} else if !a.visited.Visit(value) {
+				continue
+			}
+			a.applyStruct(value.Elem(), reflectx.JoinPath(path, f.name)) // recurse
+
+		case elemsField:
+			a.applyLeaf(value, f, path)
+			a.applyElems(value, reflectx.JoinPath(path, f.name))
+
+		case leafField:
+			a.applyLeaf(value, f, path)
+		}
+	}
+	if p.defaulter && a.mode != diffMode {
+		callDefaulter(v)
+	}
+}
+
+// applyLeaf sets a field to its default value, or compares it with its
+// default value in diff mode.
+func (a *applier) applyLeaf(value reflect.Value, f *fieldPlan, path string) {
+	if a.mode == applyMode && !value.IsZero() {
+		// A value is set on this field so there's no need to set a default
+		// value.
+		return
+	}
+
+	def, err := a.defaultValue(f)
+	if err != nil {
+		err.Path = reflectx.JoinPath(path, f.name)
+		a.errs = append(a.errs, err)
+		return
+	}
+
+	if a.mode == diffMode {
+		if def.IsValid() && !reflect.DeepEqual(value.Interface(), def.Interface()) {
+			a.diffs = append(a.diffs, Difference{
+				Path:    reflectx.JoinPath(path, f.name),
+				Default: def.Interface(),
+				Value:   value.Interface(),
+			})
+		}
+		return
+	}
+
+	if def.IsValid() {
+		value.Set(def)
+	}
+	if f.defaulter {
+		callDefaulter(value)
+	}
+}
+
+// defaultValue returns the default value of a field, or an invalid value if
+// the field has no default.
+func (a *applier) defaultValue(f *fieldPlan) (reflect.Value, *FieldError) {
+	switch {
+	case f.tag == "":
+		return reflect.Value{}, nil
+
+	case f.dynamic && a.lookup != nil:
+		tagVal, err := expand(f.tag, a.lookup)
+		if err != nil {
+			return reflect.Value{}, &FieldError{Tag: f.tag, Err: err}
+		}
+		if tagVal == "" {
+			return reflect.Value{}, nil
+		}
+		v := reflect.New(f.value.Type()).Elem()
+		if err := setValue(v, tagVal); err != nil {
+			return reflect.Value{}, &FieldError{Tag: tagVal, Err: err}
+		}
+		return v, nil
+
+	case f.err != nil:
+		return reflect.Value{}, &FieldError{Tag: f.tag, Err: f.err}
+
+	case f.reparse:
+		v := reflect.New(f.value.Type()).Elem()
+		if err := setValue(v, f.tag); err != nil {
+			return reflect.Value{}, &FieldError{Tag: f.tag, Err: err}
+		}
+		return v, nil
+
+	default:
+		return clone(f.value), nil
+	}
+}
+
+// applyElems applies defaults to the structs held by v, which is a struct, a
+// pointer or a slice, array or map of them. Nil pointers are left untouched.
+func (a *applier) applyElems(v reflect.Value, path string) {
+	switch v.Kind() {
+	case reflect.Struct:
+		a.applyStruct(v, path)
+
+	case reflect.Ptr:
+		if v.IsNil() || !a.visited.Visit(v) {
+			return
+		}
+		a.applyElems(v.Elem(), path)
+
+	case reflect.Slice:
+		if v.IsNil() || !a.visited.Visit(v) {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			a.applyElems(v.Index(i), path+"["+strconv.Itoa(i)+"]")
+		}
+
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			a.applyElems(v.Index(i), path+"["+strconv.Itoa(i)+"]")
+		}
+
+	case reflect.Map:
+		if v.IsNil() || !a.visited.Visit(v) {
+			return
+		}
+		// Map values aren't addressable, structs and arrays are applied to a
+		// copy which is stored back. Diff only reads them.
+		copyElem := a.mode != diffMode &&
+			(v.Type().Elem().Kind() == reflect.Struct || v.Type().Elem().Kind() == reflect.Array)
+		iter := v.MapRange()
+		for iter.Next() {
+			elemPath := fmt.Sprintf("%s[%v]", path, iter.Key())
+			if !copyElem {
+				a.applyElems(iter.Value(), elemPath)
+				continue
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			a.applyElems(elem, elemPath)
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package ferr_test
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/zzjcool/goutils/ferr"
@@ -86,3 +87,61 @@ func TestConvert(t *testing.T) {
 		t.Errorf(`normalErr2 == normalErr2`)
 	}
 }
+
+func panicSite() {
+	panic("boom")
+}
+
+func TestRecover(t *testing.T) {
+	err := func() (err error) {
+		defer ferr.Recover(&err)
+		panicSite()
+		return nil
+	}()
+	if err == nil {
+		t.Fatal("expected an error from the panic")
+	}
+	if err.Error() != "panic: boom" {
+		t.Errorf(`err.Error() = %q, want %q`, err.Error(), "panic: boom")
+	}
+	stack := ferr.Convert(err).Stack()
+	if !strings.Contains(strings.SplitN(stack, "\n", 3)[1], "panicSite") {
+		t.Errorf("stack should start at the panic site, got:\n%s", stack)
+	}
+}
+
+func TestRecoverError(t *testing.T) {
+	cause := errors.New("cause")
+	err := func() (err error) {
+		defer ferr.Recover(&err)
+		panic(cause)
+	}()
+	if !ferr.Convert(err).Contain(cause) {
+		t.Errorf("panic error should contain the panicked error")
+	}
+}
+
+func TestGo(t *testing.T) {
+	ch := make(chan ferr.Interface, 1)
+	ferr.SetPanicHandler(func(err ferr.Interface) {
+		ch <- err
+	})
+	defer ferr.SetPanicHandler(nil)
+
+	ferr.Go(func() error {
+		panicSite()
+		return nil
+	})
+	err := <-ch
+	if !strings.Contains(err.Stack(), "panicSite") {
+		t.Errorf("stack should contain the panic site, got:\n%s", err.Stack())
+	}
+
+	ferr.Go(func() error {
+		return errors.New("failed")
+	})
+	err = <-ch
+	if err.Error() != "failed" {
+		t.Errorf(`err.Error() = %q, want %q`, err.Error(), "failed")
+	}
+}
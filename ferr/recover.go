@@ -0,0 +1,95 @@
+package ferr
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// PanicHandler 处理Go启动的goroutine中产生的错误
+type PanicHandler func(err Interface)
+
+var panicHandler atomic.Pointer[PanicHandler]
+
+func init() {
+	SetPanicHandler(nil)
+}
+
+func defaultPanicHandler(err Interface) {
+	fmt.Fprint(os.Stderr, err.TraceStack())
+}
+
+// SetPanicHandler 设置Go使用的错误处理函数，为nil时恢复默认处理：将TraceStack输出到标准错误
+func SetPanicHandler(h PanicHandler) {
+	if h == nil {
+		h = defaultPanicHandler
+	}
+	panicHandler.Store(&h)
+}
+
+// Recover 用于defer中捕获panic，并将其转换为带有panic现场堆栈的错误写入errp
+//
+//	func do() (err error) {
+//		defer ferr.Recover(&err)
+//		...
+//	}
+func Recover(errp *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	err := fromPanic(r)
+	if errp != nil {
+		*errp = err
+	}
+}
+
+// Go 启动一个goroutine执行f，f返回的错误或者产生的panic都会交给PanicHandler处理
+func Go(f func() error) {
+	go func() {
+		var err error
+		defer func() {
+			if err != nil {
+				(*panicHandler.Load())(Convert(err))
+			}
+		}()
+		defer Recover(&err)
+		err = f()
+	}()
+}
+
+// fromPanic 将recover得到的值转换为错误，堆栈从panic发生的位置开始
+func fromPanic(r any) *ferr {
+	var pcs [64]uintptr
+	n := runtime.Callers(3, pcs[:])
+
+	f := &ferr{
+		err: fmt.Errorf("panic: %v", r),
+		pcs: panicPcs(pcs[:n]),
+	}
+	if e, ok := r.(error); ok {
+		f.cause = Convert(e)
+	}
+	return f
+}
+
+// panicPcs 跳过recover一侧的调用栈以及runtime内部的panic函数，只保留panic现场的调用栈
+func panicPcs(pcs []uintptr) []uintptr {
+	for i, pc := range pcs {
+		fn := runtime.FuncForPC(pc - 1)
+		if fn == nil || fn.Name() != "runtime.gopanic" {
+			continue
+		}
+		j := i + 1
+		for ; j < len(pcs); j++ {
+			fn := runtime.FuncForPC(pcs[j] - 1)
+			if fn == nil || !strings.HasPrefix(fn.Name(), "runtime.") {
+				break
+			}
+		}
+		return pcs[j:]
+	}
+	return pcs
+}
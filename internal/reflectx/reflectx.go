@@ -0,0 +1,122 @@
+// Package reflectx defaults、vtor和zconf共用的反射工具，保证它们对叶子类型的判断一致
+package reflectx
+
+import (
+	"encoding"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var (
+	DurationType        = reflect.TypeOf(time.Duration(0))
+	TimeType            = reflect.TypeOf(time.Time{})
+	TextUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+var (
+	textTypesMu sync.RWMutex
+	textTypes   = map[reflect.Type]bool{}
+)
+
+// RegisterText 将t注册为以文本表示的类型，例如defaults.RegisterParser注册的类型，text为false时取消注册
+func RegisterText(t reflect.Type, text bool) {
+	textTypesMu.Lock()
+	defer textTypesMu.Unlock()
+	if text {
+		textTypes[t] = true
+	} else {
+		delete(textTypes, t)
+	}
+}
+
+// IsText 判断t是否作为一个整体以文本表示，而不是展开其中的字段：
+// time.Time、RegisterText注册的类型和实现了encoding.TextUnmarshaler的类型
+func IsText(t reflect.Type) bool {
+	if t == TimeType {
+		return true
+	}
+	textTypesMu.RLock()
+	text := textTypes[t]
+	textTypesMu.RUnlock()
+	return text || reflect.PointerTo(t).Implements(TextUnmarshalerType)
+}
+
+// OnStack 判断t是否在stack中，用于避免递归的类型无限展开
+func OnStack(stack []reflect.Type, t reflect.Type) bool {
+	for _, s := range stack {
+		if s == t {
+			return true
+		}
+	}
+	return false
+}
+
+// JoinPath 使用.连接路径，例如Server.Port
+func JoinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+type visit struct {
+	typ reflect.Type
+	ptr uintptr
+}
+
+// Visited 记录遍历过的指针、切片和map，使循环引用的值只遍历一次。零值可以直接使用，
+// 第一次记录根以外的值时才分配内存
+type Visited struct {
+	root visit
+	m    map[visit]struct{}
+}
+
+// Root 记录遍历的起点，例如传入的结构体指针
+func (v *Visited) Root(val reflect.Value) {
+	v.root = visit{typ: val.Type(), ptr: val.Pointer()}
+}
+
+// Visit 记录指针、切片或map，已经遍历过时返回false
+func (v *Visited) Visit(val reflect.Value) bool {
+	key := visit{typ: val.Type(), ptr: val.Pointer()}
+	if key == v.root {
+		return false
+	}
+	if _, ok := v.m[key]; ok {
+		return false
+	}
+	if v.m == nil {
+		v.m = make(map[visit]struct{})
+	}
+	v.m[key] = struct{}{}
+	return true
+}
+
+// Cache 按类型缓存编译的结果，例如解析好的结构体标签，可以并发使用
+type Cache[P any] struct {
+	m       sync.Map // map[reflect.Type]P
+	compile func(reflect.Type) P
+}
+
+// NewCache 创建Cache，类型第一次使用时调用compile
+func NewCache[P any](compile func(reflect.Type) P) *Cache[P] {
+	return &Cache[P]{compile: compile}
+}
+
+// Get 获取t编译的结果，第一次使用时编译
+func (c *Cache[P]) Get(t reflect.Type) P {
+	if p, ok := c.m.Load(t); ok {
+		return p.(P)
+	}
+	p, _ := c.m.LoadOrStore(t, c.compile(t))
+	return p.(P)
+}
+
+// Reset 清空缓存，例如解析的规则变化之后
+func (c *Cache[P]) Reset() {
+	c.m.Range(func(key, _ any) bool {
+		c.m.Delete(key)
+		return true
+	})
+}
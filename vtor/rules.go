@@ -0,0 +1,279 @@
+package vtor
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zzjcool/goutils/internal/reflectx"
+)
+
+// Field 规则校验的字段
+type Field struct {
+	Value  reflect.Value // 字段的值，指针已经解引用
+	Param  string        // 规则的参数，例如min=1中的1
+	Parent reflect.Value // 字段所在的结构体，用于跨字段的规则
+}
+
+// Func 校验字段是否满足规则
+type Func func(f Field) bool
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]Func{
+		"min":      func(f Field) bool { return compare(f, "min") >= 0 },
+		"max":      func(f Field) bool { return compare(f, "max") <= 0 },
+		"len":      func(f Field) bool { return length(f, "len") == mustInt(f.Param, "len") },
+		"oneof":    oneOf,
+		"regexp":   matchRegexp,
+		"email":    isEmail,
+		"url":      isURL,
+		"eqfield":  fieldRule("eqfield", func(c int) bool { return c == 0 }),
+		"nefield":  fieldRule("nefield", func(c int) bool { return c != 0 }),
+		"gtfield":  fieldRule("gtfield", func(c int) bool { return c > 0 }),
+		"gtefield": fieldRule("gtefield", func(c int) bool { return c >= 0 }),
+		"ltfield":  fieldRule("ltfield", func(c int) bool { return c < 0 }),
+		"ltefield": fieldRule("ltefield", func(c int) bool { return c <= 0 }),
+	}
+)
+
+// conditions 判断字段是否必填的规则，只在字段为空时检查，Func返回true表示字段必填
+var conditions = map[string]Func{
+	"required_if": func(f Field) bool {
+		name, value := splitParam(f.Param, "required_if")
+		return formatField(f.Parent, name, "required_if") == value
+	},
+	"required_unless": func(f Field) bool {
+		name, value := splitParam(f.Param, "required_unless")
+		return formatField(f.Parent, name, "required_unless") != value
+	},
+	"required_with": func(f Field) bool {
+		return !isEmpty(sibling(f.Parent, f.Param, "required_with"))
+	},
+	"required_without": func(f Field) bool {
+		return isEmpty(sibling(f.Parent, f.Param, "required_without"))
+	},
+}
+
+// Register 注册自定义的规则，之后可以在标签中使用name=param，param通过Field.Param获取。
+// 可以覆盖内置的规则，但不能覆盖required、omitempty和required_*。一般在init中调用。
+func Register(name string, fn Func) {
+	if name == "" || name == "required" || name == "omitempty" || conditions[name] != nil ||
+		strings.ContainsAny(name, ",= ") {
+		panic("vtor: invalid rule name " + strconv.Quote(name))
+	}
+	if fn == nil {
+		panic("vtor: nil rule " + name)
+	}
+	rulesMu.Lock()
+	rules[name] = fn
+	rulesMu.Unlock()
+	plans.Reset()
+}
+
+func lookupRule(name string) (Func, bool) {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	fn, ok := rules[name]
+	return fn, ok
+}
+
+// compare 比较字段与参数的大小，字符串、切片和map比较长度
+func compare(f Field, rule string) int {
+	v := f.Value
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return cmp(length(f, rule), mustInt(f.Param, rule))
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// time.Duration可以使用时间格式，例如min=1s，没有单位时为纳秒数
+		if v.Type() == reflectx.DurationType {
+			if d, err := time.ParseDuration(f.Param); err == nil {
+				return cmp(v.Int(), int64(d))
+			}
+		}
+		n, err := strconv.ParseInt(f.Param, 0, 64)
+		if err != nil {
+			panic(fmt.Sprintf("vtor: invalid %s parameter %q: %v", rule, f.Param, err))
+		}
+		return cmp(v.Int(), n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(f.Param, 0, 64)
+		if err != nil {
+			panic(fmt.Sprintf("vtor: invalid %s parameter %q: %v", rule, f.Param, err))
+		}
+		return cmp(v.Uint(), n)
+
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(f.Param, 64)
+		if err != nil {
+			panic(fmt.Sprintf("vtor: invalid %s parameter %q: %v", rule, f.Param, err))
+		}
+		return cmp(v.Float(), n)
+
+	default:
+		panic(fmt.Sprintf("vtor: rule %s does not support %v", rule, v.Type()))
+	}
+}
+
+func cmp[T int | int64 | uint64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// length 获取字符串的字符数，或者切片、数组和map的长度
+func length(f Field, rule string) int {
+	switch f.Value.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(f.Value.String())
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return f.Value.Len()
+	default:
+		panic(fmt.Sprintf("vtor: rule %s does not support %v", rule, f.Value.Type()))
+	}
+}
+
+func mustInt(param, rule string) int {
+	n, err := strconv.Atoi(param)
+	if err != nil {
+		panic(fmt.Sprintf("vtor: invalid %s parameter %q: %v", rule, param, err))
+	}
+	return n
+}
+
+func oneOf(f Field) bool {
+	var s string
+	switch v := f.Value; v.Kind() {
+	case reflect.String:
+		s = v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s = strconv.FormatUint(v.Uint(), 10)
+	default:
+		panic(fmt.Sprintf("vtor: rule oneof does not support %v", v.Type()))
+	}
+	for _, item := range strings.Fields(f.Param) {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// regexps 缓存编译好的正则表达式
+var regexps sync.Map // map[string]*regexp.Regexp
+
+func matchRegexp(f Field) bool {
+	re, ok := regexps.Load(f.Param)
+	if !ok {
+		re, _ = regexps.LoadOrStore(f.Param, regexp.MustCompile(f.Param))
+	}
+	return re.(*regexp.Regexp).MatchString(mustString(f, "regexp"))
+}
+
+func isEmail(f Field) bool {
+	s := mustString(f, "email")
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+
+func isURL(f Field) bool {
+	u, err := url.Parse(mustString(f, "url"))
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+func mustString(f Field, rule string) string {
+	if f.Value.Kind() != reflect.String {
+		panic(fmt.Sprintf("vtor: rule %s does not support %v", rule, f.Value.Type()))
+	}
+	return f.Value.String()
+}
+
+// sibling 获取同一结构体中名为name的字段，指针会被解引用
+func sibling(parent reflect.Value, name, rule string) reflect.Value {
+	if parent.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("vtor: rule %s needs a struct field", rule))
+	}
+	v := parent.FieldByName(name)
+	if !v.IsValid() {
+		panic(fmt.Sprintf("vtor: rule %s: %v has no field %s", rule, parent.Type(), name))
+	}
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+// formatField 将同一结构体中名为name的字段格式化为字符串，nil指针为空字符串
+func formatField(parent reflect.Value, name, rule string) string {
+	v := sibling(parent, name, rule)
+	if v.Kind() == reflect.Ptr {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func splitParam(param, rule string) (string, string) {
+	name, value, ok := strings.Cut(param, " ")
+	if !ok {
+		panic(fmt.Sprintf("vtor: invalid %s parameter %q, expected \"Field value\"", rule, param))
+	}
+	return name, strings.TrimSpace(value)
+}
+
+// fieldRule 根据字段与另一个字段的比较结果生成规则，无法比较时只有nefield成立
+func fieldRule(rule string, pred func(c int) bool) Func {
+	return func(f Field) bool {
+		c, ok := compareField(f, rule)
+		if !ok {
+			return rule == "nefield"
+		}
+		return pred(c)
+	}
+}
+
+// compareField 比较字段与同一结构体中名为Param的字段的大小，另一个字段为nil，
+// 或者类型只能判断是否相等且两者不相等时返回false
+func compareField(f Field, rule string) (int, bool) {
+	o := sibling(f.Parent, f.Param, rule)
+	v := f.Value
+	if o.Kind() == reflect.Ptr {
+		return 0, false
+	}
+	if v.Type() != o.Type() {
+		panic(fmt.Sprintf("vtor: rule %s can't compare %v with %v", rule, v.Type(), o.Type()))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return strings.Compare(v.String(), o.String()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmp(v.Int(), o.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return cmp(v.Uint(), o.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return cmp(v.Float(), o.Float()), true
+	}
+	if v.Type() == reflectx.TimeType {
+		return v.Interface().(time.Time).Compare(o.Interface().(time.Time)), true
+	}
+	if (rule == "eqfield" || rule == "nefield") && v.Type().Comparable() {
+		return 0, v.Equal(o)
+	}
+	panic(fmt.Sprintf("vtor: rule %s does not support %v", rule, v.Type()))
+}
@@ -0,0 +1,347 @@
+package vtor
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/zzjcool/goutils/defaults"
+	"github.com/zzjcool/goutils/internal/reflectx"
+)
+
+// SchemaDraft JSONSchema生成的JSON Schema版本
+const SchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema JSON Schema，可以直接使用json.Marshal输出
+type Schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Defs        map[string]*Schema `json:"$defs,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Default     any                `json:"default,omitempty"`
+	Enum        []any              `json:"enum,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	MinProperties        *int               `json:"minProperties,omitempty"`
+	MaxProperties        *int               `json:"maxProperties,omitempty"`
+
+	Items    *Schema `json:"items,omitempty"`
+	MinItems *int    `json:"minItems,omitempty"`
+	MaxItems *int    `json:"maxItems,omitempty"`
+
+	MinLength *int   `json:"minLength,omitempty"`
+	MaxLength *int   `json:"maxLength,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+
+	Minimum json.Number `json:"minimum,omitempty"`
+	Maximum json.Number `json:"maximum,omitempty"`
+}
+
+// JSONSchema 根据结构体生成JSON Schema (draft 2020-12)。
+//
+// 属性名依次取json标签、yaml标签和字段名，default标签作为默认值，vtor标签中的
+// required、min、max、len、oneof、regexp、email和url转换为对应的约束，其他规则会被忽略。
+// 除了t本身，命名的结构体类型会放在$defs中通过$ref引用，以支持递归的类型。
+func JSONSchema(t reflect.Type) *Schema {
+	g := &schemaGen{defs: map[string]*Schema{}, names: map[reflect.Type]string{}}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var s *Schema
+	if t.Kind() == reflect.Struct && !reflectx.IsText(t) {
+		g.names[t] = "#"
+		s = g.structSchema(t)
+	} else {
+		s = g.schema(t)
+	}
+	s.Schema = SchemaDraft
+	if len(g.defs) > 0 {
+		s.Defs = g.defs
+	}
+	return s
+}
+
+type schemaGen struct {
+	defs  map[string]*Schema
+	names map[reflect.Type]string // 已经生成的结构体类型对应的$ref
+}
+
+func (g *schemaGen) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == reflectx.DurationType:
+		return &Schema{Type: "string"}
+	case t == reflectx.TimeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case reflectx.IsText(t):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer", Minimum: "0"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string"}
+		}
+		s := &Schema{Type: "array", Items: g.schema(t.Elem())}
+		if t.Kind() == reflect.Array {
+			s.MinItems, s.MaxItems = intPtr(t.Len()), intPtr(t.Len())
+		}
+		return s
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		return g.structRef(t)
+	default:
+		return &Schema{}
+	}
+}
+
+// structRef 命名的结构体类型放在$defs中并返回$ref，匿名的结构体直接展开
+func (g *schemaGen) structRef(t reflect.Type) *Schema {
+	if ref, ok := g.names[t]; ok {
+		return &Schema{Ref: ref}
+	}
+	if t.Name() == "" {
+		return g.structSchema(t)
+	}
+
+	name := t.Name()
+	for i := 2; g.defs[name] != nil; i++ {
+		name = t.Name() + strconv.Itoa(i)
+	}
+	ref := "#/$defs/" + name
+	g.names[t] = ref
+	g.defs[name] = &Schema{} // 占位，避免递归的类型重名
+	g.defs[name] = g.structSchema(t)
+	return &Schema{Ref: ref}
+}
+
+func (g *schemaGen) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	// 通过defaults获取解析后的默认值，解析失败的字段不输出默认值
+	dv := reflect.New(t)
+	failed := map[string]bool{}
+	if err := defaults.Apply(dv.Interface()); err != nil {
+		for _, e := range unwrapAll(err) {
+			var fe *defaults.FieldError
+			if errors.As(e, &fe) {
+				failed[fe.Path] = true
+			}
+		}
+	}
+
+	g.addFields(s, t, dv.Elem(), "", failed)
+	return s
+}
+
+func (g *schemaGen) addFields(s *Schema, t reflect.Type, dv reflect.Value, path string, failed map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, inline := propertyName(field)
+		if name == "-" {
+			continue
+		}
+		fieldPath := reflectx.JoinPath(path, field.Name)
+
+		if inline {
+			ft, fv := field.Type, dv.Field(i)
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+				if fv.IsNil() {
+					fv = reflect.New(ft)
+				}
+				fv = fv.Elem()
+			}
+			g.addFields(s, ft, fv, fieldPath, failed)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		prop := g.schema(field.Type)
+		// $ref不能和其他约束一起使用，只保留required
+		if prop.Ref == "" {
+			tag := field.Tag.Get("default")
+			if tag != "" && tag != "-" && !failed[fieldPath] {
+				prop.Default = defaultValue(field.Type, tag, dv.Field(i))
+			}
+			applyRules(prop, field)
+		}
+		if hasRequired(field) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = prop
+	}
+}
+
+// unwrapAll 展开errors.Join合并的错误
+func unwrapAll(err error) []error {
+	if u, ok := err.(interface{ Unwrap() []error }); ok {
+		return u.Unwrap()
+	}
+	return []error{err}
+}
+
+// propertyName 获取字段对应的属性名，inline表示没有指定名称的嵌入结构体，其字段属于外层结构体
+func propertyName(field reflect.StructField) (name string, inline bool) {
+	for _, key := range []string{"json", "yaml"} {
+		tag, ok := field.Tag.Lookup(key)
+		if !ok {
+			continue
+		}
+		name, _, _ = strings.Cut(tag, ",")
+		if name != "" {
+			return name, false
+		}
+		break
+	}
+
+	ft := field.Type
+	if ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	if field.Anonymous && ft.Kind() == reflect.Struct {
+		return "", true
+	}
+	return field.Name, false
+}
+
+// defaultValue 获取字段解析后的默认值，文本格式的类型直接使用标签
+func defaultValue(t reflect.Type, tag string, v reflect.Value) any {
+	for t.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		t, v = t.Elem(), v.Elem()
+	}
+	if t == reflectx.DurationType || reflectx.IsText(t) {
+		return tag
+	}
+	return v.Interface()
+}
+
+func hasRequired(field reflect.StructField) bool {
+	for _, r := range parseTag(field.Tag.Get("vtor")) {
+		if r.name == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRules 将vtor标签中的规则转换为schema的约束
+func applyRules(s *Schema, field reflect.StructField) {
+	t := field.Type
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	for _, r := range parseTag(field.Tag.Get("vtor")) {
+		switch r.name {
+		case "min", "max", "len":
+			applyBound(s, t, r)
+		case "oneof":
+			for _, item := range strings.Fields(r.param) {
+				s.Enum = append(s.Enum, enumValue(t, item))
+			}
+		case "regexp":
+			s.Pattern = r.param
+		case "email":
+			s.Format = "email"
+		case "url":
+			s.Format = "uri"
+		}
+	}
+}
+
+func applyBound(s *Schema, t reflect.Type, r rule) {
+	min, max := r.name == "min" || r.name == "len", r.name == "max" || r.name == "len"
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		if t == reflectx.DurationType || r.name == "len" {
+			return
+		}
+		if _, err := strconv.ParseFloat(r.param, 64); err != nil {
+			return
+		}
+		if min {
+			s.Minimum = json.Number(r.param)
+		}
+		if max {
+			s.Maximum = json.Number(r.param)
+		}
+		return
+	}
+
+	n, err := strconv.Atoi(r.param)
+	if err != nil {
+		return
+	}
+	switch s.Type {
+	case "string":
+		if min {
+			s.MinLength = intPtr(n)
+		}
+		if max {
+			s.MaxLength = intPtr(n)
+		}
+	case "array":
+		if min {
+			s.MinItems = intPtr(n)
+		}
+		if max {
+			s.MaxItems = intPtr(n)
+		}
+	case "object":
+		if min {
+			s.MinProperties = intPtr(n)
+		}
+		if max {
+			s.MaxProperties = intPtr(n)
+		}
+	}
+}
+
+// enumValue 将oneof中的值转换为字段对应的类型
+func enumValue(t reflect.Type, item string) any {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, err := strconv.ParseInt(item, 10, 64); err == nil {
+			return n
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n, err := strconv.ParseUint(item, 10, 64); err == nil {
+			return n
+		}
+	}
+	return item
+}
+
+func intPtr(n int) *int {
+	return &n
+}
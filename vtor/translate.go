@@ -0,0 +1,112 @@
+package vtor
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// Translator 将未通过校验的字段翻译为对应语言的描述
+type Translator interface {
+	Translate(e *FieldError) string
+}
+
+// Messages 基于模板的Translator，key为规则名，模板中的{field}、{param}和{rule}
+// 会被替换为字段路径、规则参数和规则名。没有对应模板的规则使用key为""的模板。
+type Messages map[string]string
+
+// Translate 实现Translator
+func (m Messages) Translate(e *FieldError) string {
+	msg, ok := m[e.Rule]
+	if !ok {
+		msg = m[""]
+	}
+	return strings.NewReplacer("{field}", e.Path, "{param}", e.Param, "{rule}", e.Rule).Replace(msg)
+}
+
+// With 返回增加或者替换了部分模板的副本，用于为自定义规则添加描述
+func (m Messages) With(msgs Messages) Messages {
+	c := make(Messages, len(m)+len(msgs))
+	for k, v := range m {
+		c[k] = v
+	}
+	for k, v := range msgs {
+		c[k] = v
+	}
+	return c
+}
+
+var (
+	// English 英文描述
+	English = Messages{
+		"":                 "{field} failed on rule {rule}",
+		"required":         "{field} is required",
+		"required_if":      "{field} is required when {param}",
+		"required_unless":  "{field} is required unless {param}",
+		"required_with":    "{field} is required when {param} is set",
+		"required_without": "{field} is required when {param} is not set",
+		"min":              "{field} must be at least {param}",
+		"max":              "{field} must be at most {param}",
+		"len":              "{field} length must be {param}",
+		"oneof":            "{field} must be one of [{param}]",
+		"regexp":           "{field} must match {param}",
+		"email":            "{field} must be a valid email address",
+		"url":              "{field} must be a valid URL",
+		"eqfield":          "{field} must be equal to {param}",
+		"nefield":          "{field} must not be equal to {param}",
+		"gtfield":          "{field} must be greater than {param}",
+		"gtefield":         "{field} must be greater than or equal to {param}",
+		"ltfield":          "{field} must be less than {param}",
+		"ltefield":         "{field} must be less than or equal to {param}",
+	}
+
+	// Chinese 中文描述
+	Chinese = Messages{
+		"":                 "{field}未通过{rule}校验",
+		"required":         "{field}为必填字段",
+		"required_if":      "{field}在{param}时为必填字段",
+		"required_unless":  "{field}在{param}以外的情况下为必填字段",
+		"required_with":    "{field}在设置了{param}时为必填字段",
+		"required_without": "{field}在没有设置{param}时为必填字段",
+		"min":              "{field}不能小于{param}",
+		"max":              "{field}不能大于{param}",
+		"len":              "{field}的长度必须为{param}",
+		"oneof":            "{field}必须是[{param}]中的一个",
+		"regexp":           "{field}必须匹配{param}",
+		"email":            "{field}必须是合法的邮箱地址",
+		"url":              "{field}必须是合法的URL",
+		"eqfield":          "{field}必须等于{param}",
+		"nefield":          "{field}不能等于{param}",
+		"gtfield":          "{field}必须大于{param}",
+		"gtefield":         "{field}必须大于或等于{param}",
+		"ltfield":          "{field}必须小于{param}",
+		"ltefield":         "{field}必须小于或等于{param}",
+	}
+)
+
+var translator atomic.Pointer[Translator]
+
+func init() {
+	SetTranslator(English)
+}
+
+// SetTranslator 设置FieldError.Error使用的Translator，默认为English
+func SetTranslator(t Translator) {
+	if t == nil {
+		t = English
+	}
+	translator.Store(&t)
+}
+
+// Translate 使用t翻译字段的错误信息
+func (e *FieldError) Translate(t Translator) string {
+	return t.Translate(e)
+}
+
+// Translate 使用t翻译所有字段的错误信息
+func (e Errors) Translate(t Translator) []string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Translate(t)
+	}
+	return msgs
+}
@@ -1,4 +1,300 @@
 /*
 vtor 校验器
+
+根据结构体字段的vtor标签校验字段的值，多个规则使用逗号分隔：
+
+	type Config struct {
+		Port  int    `vtor:"required,min=1,max=65535"`
+		Level string `vtor:"oneof=debug info warn"`
+		Name  string `vtor:"omitempty,regexp=^[a-z]+$"`
+	}
+
+	err := vtor.Validate(&conf)
+
+支持的规则：
+
+	required  不能为零值，切片、map和字符串不能为空，指针不能为nil
+	omitempty 值为零值时跳过其他规则
+	min=N     数字不小于N，字符串、切片和map的长度不小于N
+	max=N     数字不大于N，字符串、切片和map的长度不大于N
+	len=N     字符串、切片和map的长度等于N
+	oneof=a b 值为空格分隔的列表中的一个
+	regexp=re 字符串匹配正则表达式，regexp需要是最后一个规则，其中可以包含逗号
+	email     字符串为合法的邮箱地址
+	url       字符串为合法的URL，需要包含scheme和host
+
+跨字段的规则，参数为同一结构体中的另一个字段：
+
+	eqfield=F           等于字段F
+	nefield=F           不等于字段F
+	gtfield=F           大于字段F，gtefield、ltfield、ltefield同理
+	required_if=F v     字段F的值为v时必填
+	required_unless=F v 字段F的值不为v时必填
+	required_with=F     字段F不为空时必填
+	required_without=F  字段F为空时必填
+
+time.Duration类型的min和max可以使用时间格式，例如min=1s，没有单位时为纳秒数，例如max=0。
+
+自定义的规则通过Register注册。错误信息默认为英文，可以通过SetTranslator设置为中文，
+或者使用FieldError.Translate按需翻译。
+
+嵌套的结构体，以及切片、数组和map中的结构体都会被递归校验，所有未通过的字段会一起返回。
+
+JSONSchema根据结构体的json或yaml标签、default标签和vtor规则生成JSON Schema：
+
+	b, _ := json.MarshalIndent(vtor.JSONSchema(reflect.TypeOf(Config{})), "", "  ")
 */
 package vtor
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/zzjcool/goutils/internal/reflectx"
+)
+
+// FieldError 字段未通过校验的信息
+type FieldError struct {
+	Path  string // 字段路径，例如Server.TLS.Port
+	Rule  string // 未通过的规则，例如min
+	Param string // 规则的参数，例如min=1中的1
+	Value any    // 字段的值
+}
+
+func (e *FieldError) Error() string {
+	return e.Translate(*translator.Load())
+}
+
+// Errors 所有未通过校验的字段
+type Errors []*FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap 使errors.As可以取到其中的*FieldError
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, fe := range e {
+		errs[i] = fe
+	}
+	return errs
+}
+
+// Validate 校验v中所有带有vtor标签的字段，v可以是结构体、结构体指针，或者包含结构体的切片和map。
+// 校验通过时返回nil，否则返回Errors。标签中的规则有误时会panic。
+func Validate(v any) error {
+	w := &walker{}
+	w.walk(reflect.ValueOf(v), "")
+	if len(w.errs) == 0 {
+		return nil
+	}
+	return w.errs
+}
+
+// plans 缓存每个结构体类型解析好的规则
+var plans = reflectx.NewCache(compile)
+
+type plan struct {
+	fields []fieldPlan
+}
+
+type fieldPlan struct {
+	index      int
+	name       string
+	required   bool
+	omitempty  bool
+	conditions []rule // required_if等规则
+	rules      []rule
+}
+
+type rule struct {
+	name  string
+	param string
+	fn    Func
+}
+
+func compile(t reflect.Type) *plan {
+	p := &plan{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// 未导出的字段无法读取，嵌入的结构体除外
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		f := fieldPlan{index: i, name: field.Name}
+		for _, r := range parseTag(field.Tag.Get("vtor")) {
+			switch r.name {
+			case "required":
+				f.required = true
+			case "omitempty":
+				f.omitempty = true
+			default:
+				if fn, ok := conditions[r.name]; ok {
+					r.fn = fn
+					f.conditions = append(f.conditions, r)
+					continue
+				}
+				fn, ok := lookupRule(r.name)
+				if !ok {
+					panic("vtor: unknown rule " + strconv.Quote(r.name) + " on field " + t.String() + "." + field.Name)
+				}
+				r.fn = fn
+				f.rules = append(f.rules, r)
+			}
+		}
+		p.fields = append(p.fields, f)
+	}
+	return p
+}
+
+// parseTag 解析标签中的规则，regexp会包含标签剩余的所有内容
+func parseTag(tag string) []rule {
+	var rs []rule
+	for tag != "" {
+		var item string
+		if strings.HasPrefix(strings.TrimSpace(tag), "regexp=") {
+			item, tag = tag, ""
+		} else {
+			item, tag, _ = strings.Cut(tag, ",")
+		}
+		item = strings.TrimSpace(item)
+		if item == "" || item == "-" {
+			continue
+		}
+		name, param, _ := strings.Cut(item, "=")
+		rs = append(rs, rule{name: name, param: param})
+	}
+	return rs
+}
+
+// walker 保存一次校验的状态
+type walker struct {
+	errs    Errors
+	visited reflectx.Visited // 已经校验过的指针、切片和map，避免循环引用
+}
+
+// walk 递归查找v中的结构体并校验
+func (w *walker) walk(v reflect.Value, path string) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || !w.visited.Visit(v) {
+			return
+		}
+		w.walk(v.Elem(), path)
+
+	case reflect.Interface:
+		if !v.IsNil() {
+			w.walk(v.Elem(), path)
+		}
+
+	case reflect.Struct:
+		w.validateStruct(v, path)
+
+	case reflect.Slice:
+		if v.IsNil() || !mayHoldStructs(v.Type().Elem()) || !w.visited.Visit(v) {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			w.walk(v.Index(i), path+"["+strconv.Itoa(i)+"]")
+		}
+
+	case reflect.Array:
+		if !mayHoldStructs(v.Type().Elem()) {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			w.walk(v.Index(i), path+"["+strconv.Itoa(i)+"]")
+		}
+
+	case reflect.Map:
+		if v.IsNil() || !mayHoldStructs(v.Type().Elem()) || !w.visited.Visit(v) {
+			return
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			w.walk(iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key()))
+		}
+	}
+}
+
+func (w *walker) validateStruct(v reflect.Value, path string) {
+	p := plans.Get(v.Type())
+	for i := range p.fields {
+		f := &p.fields[i]
+		value := v.Field(f.index)
+		fieldPath := reflectx.JoinPath(path, f.name)
+
+		if isEmpty(value) {
+			if f.required {
+				w.fail(fieldPath, "required", "", value)
+				continue
+			}
+			if w.checkConditions(f, v, fieldPath) || f.omitempty {
+				continue
+			}
+		}
+
+		val := value
+		for val.Kind() == reflect.Ptr && !val.IsNil() {
+			val = val.Elem()
+		}
+		if val.Kind() == reflect.Ptr {
+			// nil指针表示没有设置，只需要检查required
+			continue
+		}
+
+		for _, r := range f.rules {
+			if !r.fn(Field{Value: val, Param: r.param, Parent: v}) {
+				w.fail(fieldPath, r.name, r.param, val)
+			}
+		}
+		w.walk(value, fieldPath) // recurse
+	}
+}
+
+// checkConditions 检查空字段是否因为required_if等规则而必填，返回是否有未通过的规则
+func (w *walker) checkConditions(f *fieldPlan, parent reflect.Value, path string) bool {
+	failed := false
+	for _, c := range f.conditions {
+		if c.fn(Field{Param: c.param, Parent: parent}) {
+			w.fail(path, c.name, c.param, parent.Field(f.index))
+			failed = true
+		}
+	}
+	return failed
+}
+
+func (w *walker) fail(path, rule, param string, v reflect.Value) {
+	fe := &FieldError{Path: path, Rule: rule, Param: param}
+	if v.IsValid() && v.CanInterface() {
+		fe.Value = v.Interface()
+	}
+	w.errs = append(w.errs, fe)
+}
+
+// mayHoldStructs 判断类型为t的元素中是否可能有需要校验的结构体
+func mayHoldStructs(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	default:
+		return false
+	}
+}
+
+// isEmpty 判断值是否为空：零值、nil，或者长度为0
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
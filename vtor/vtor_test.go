@@ -0,0 +1,274 @@
+package vtor_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zzjcool/goutils/vtor"
+)
+
+type tls struct {
+	Port int `vtor:"min=1,max=65535"`
+}
+
+type server struct {
+	Name    string        `vtor:"required,regexp=^[a-z]{1,8}$"`
+	Port    int           `vtor:"required,min=1,max=65535"`
+	Level   string        `vtor:"oneof=debug info warn"`
+	Email   string        `vtor:"omitempty,email"`
+	Home    string        `vtor:"omitempty,url"`
+	Tags    []string      `vtor:"max=2"`
+	Code    string        `vtor:"len=4"`
+	Timeout time.Duration `vtor:"min=1s,max=1m"`
+	Weight  *uint         `vtor:"max=10"`
+	TLS     *tls
+}
+
+func validServer() server {
+	return server{
+		Name:    "api",
+		Port:    8080,
+		Level:   "info",
+		Email:   "ops@example.com",
+		Home:    "https://example.com",
+		Tags:    []string{"a"},
+		Code:    "中文代码",
+		Timeout: time.Second,
+		TLS:     &tls{Port: 443},
+	}
+}
+
+func paths(err error) []string {
+	var errs vtor.Errors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+	var ps []string
+	for _, fe := range errs {
+		ps = append(ps, fe.Path+":"+fe.Rule)
+	}
+	return ps
+}
+
+func TestValidate(t *testing.T) {
+	s := validServer()
+	if err := vtor.Validate(&s); err != nil {
+		t.Fatalf("expected valid, got %v", err)
+	}
+	if err := vtor.Validate(s); err != nil {
+		t.Fatalf("expected valid struct value, got %v", err)
+	}
+
+	weight := uint(11)
+	s = server{
+		Name:    "Invalid,Name",
+		Level:   "trace",
+		Email:   "not an email",
+		Home:    "example.com",
+		Tags:    []string{"a", "b", "c"},
+		Code:    "abc",
+		Timeout: time.Hour,
+		Weight:  &weight,
+		TLS:     &tls{Port: 70000},
+	}
+	expected := []string{
+		"Name:regexp",
+		"Port:required",
+		"Level:oneof",
+		"Email:email",
+		"Home:url",
+		"Tags:max",
+		"Code:len",
+		"Timeout:max",
+		"Weight:max",
+		"TLS.Port:max",
+	}
+	if got := paths(vtor.Validate(&s)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestValidateNested(t *testing.T) {
+	conf := struct {
+		Servers  []server
+		Backends map[string]*tls
+		Array    [1]tls
+		Any      any
+	}{
+		Servers:  []server{validServer(), {}},
+		Backends: map[string]*tls{"a": {Port: 0}},
+		Array:    [1]tls{{Port: 80}},
+		Any:      &tls{Port: -1},
+	}
+	conf.Servers[1] = validServer()
+	conf.Servers[1].Port = 0
+
+	expected := []string{"Servers[1].Port:required", "Backends[a].Port:min", "Any.Port:min"}
+	if got := paths(vtor.Validate(&conf)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := vtor.Validate(&tls{Port: 0})
+	if err == nil || err.Error() != "Port must be at least 1" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	var fe *vtor.FieldError
+	if !errors.As(err, &fe) || fe.Value != 0 || fe.Param != "1" {
+		t.Errorf("unexpected field error %+v", fe)
+	}
+}
+
+func TestDurationBound(t *testing.T) {
+	type timeouts struct {
+		Idle  time.Duration `vtor:"min=1"`
+		Retry time.Duration `vtor:"max=0"`
+		Read  time.Duration `vtor:"min=1ms,max=1s"`
+	}
+	if err := vtor.Validate(&timeouts{Idle: 1, Read: time.Millisecond}); err != nil {
+		t.Fatalf("expected valid, got %v", err)
+	}
+	expected := []string{"Idle:min", "Retry:max", "Read:max"}
+	if got := paths(vtor.Validate(&timeouts{Retry: 1, Read: time.Minute})); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestInvalidTag(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("should panic on unknown rules")
+		}
+	}()
+	_ = vtor.Validate(&struct {
+		A string `vtor:"nope"`
+	}{})
+}
+
+func TestRegister(t *testing.T) {
+	vtor.Register("tenant", func(f vtor.Field) bool {
+		return strings.HasPrefix(f.Value.String(), f.Param+"-")
+	})
+
+	type request struct {
+		Tenant string `vtor:"required,tenant=acme"`
+	}
+	if err := vtor.Validate(&request{Tenant: "acme-1"}); err != nil {
+		t.Errorf("expected valid, got %v", err)
+	}
+	err := vtor.Validate(&request{Tenant: "other-1"})
+	if got := paths(err); !reflect.DeepEqual(got, []string{"Tenant:tenant"}) {
+		t.Errorf("unexpected errors %v", got)
+	}
+	if err.Error() != "Tenant failed on rule tenant" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+
+	msgs := vtor.English.With(vtor.Messages{"tenant": "{field} must belong to {param}"})
+	if got := err.(vtor.Errors).Translate(msgs); !reflect.DeepEqual(got, []string{"Tenant must belong to acme"}) {
+		t.Errorf("unexpected translation %v", got)
+	}
+}
+
+func TestCrossField(t *testing.T) {
+	type window struct {
+		Start   time.Time
+		End     time.Time `vtor:"gtfield=Start"`
+		Min     int
+		Max     int `vtor:"gtefield=Min"`
+		Https   bool
+		Cert    string `vtor:"required_if=Https true"`
+		Plain   string `vtor:"required_unless=Https true"`
+		Key     string `vtor:"required_with=Cert"`
+		Backup  *int
+		Primary string `vtor:"required_without=Backup"`
+		Confirm string `vtor:"eqfield=Cert"`
+	}
+
+	now := time.Now()
+	valid := window{Start: now, End: now.Add(time.Hour), Min: 1, Max: 1, Https: true,
+		Cert: "c", Key: "k", Primary: "p", Confirm: "c"}
+	if err := vtor.Validate(&valid); err != nil {
+		t.Errorf("expected valid, got %v", err)
+	}
+
+	invalid := window{Start: now, End: now, Min: 2, Max: 1, Https: true, Confirm: "x"}
+	expected := []string{
+		"End:gtfield",
+		"Max:gtefield",
+		"Cert:required_if",
+		"Primary:required_without",
+		"Confirm:eqfield",
+	}
+	if got := paths(vtor.Validate(&invalid)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	invalid = window{Start: now, End: now.Add(time.Hour), Cert: "c", Confirm: "c", Primary: "p"}
+	expected = []string{"Plain:required_unless", "Key:required_with"}
+	if got := paths(vtor.Validate(&invalid)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	err := vtor.Validate(&tls{Port: 0}).(vtor.Errors)
+	if got := err.Translate(vtor.Chinese); !reflect.DeepEqual(got, []string{"Port不能小于1"}) {
+		t.Errorf("unexpected translation %v", got)
+	}
+
+	vtor.SetTranslator(vtor.Chinese)
+	defer vtor.SetTranslator(nil)
+	if err.Error() != "Port不能小于1" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+}
+
+type schemaNode struct {
+	Name     string        `json:"name" default:"root" vtor:"required,min=1,max=8"`
+	Timeout  time.Duration `json:"timeout" default:"5s"`
+	Level    string        `yaml:"level" vtor:"oneof=debug info"`
+	Ports    [2]uint16     `json:"ports"`
+	Tags     map[string]int
+	Children []*schemaNode `json:"children,omitempty"`
+	Skip     string        `json:"-"`
+}
+
+func TestJSONSchema(t *testing.T) {
+	s := vtor.JSONSchema(reflect.TypeOf(&schemaNode{}))
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":"object",` +
+		`"properties":{"Tags":{"type":"object","additionalProperties":{"type":"integer"}},` +
+		`"children":{"type":"array","items":{"$ref":"#"}},` +
+		`"level":{"type":"string","enum":["debug","info"]},` +
+		`"name":{"type":"string","default":"root","minLength":1,"maxLength":8},` +
+		`"ports":{"type":"array","items":{"type":"integer","minimum":0},"minItems":2,"maxItems":2},` +
+		`"timeout":{"type":"string","default":"5s"}},"required":["name"]}`
+	if string(b) != expected {
+		t.Errorf("unexpected schema\n%s", b)
+	}
+
+	type nested struct {
+		Node  schemaNode `vtor:"required"`
+		Count int        `default:"3" vtor:"min=1"`
+	}
+	s = vtor.JSONSchema(reflect.TypeOf(nested{}))
+	if s.Properties["Node"].Ref != "#/$defs/schemaNode" || s.Defs["schemaNode"] == nil {
+		t.Errorf("expected named struct in $defs, got %+v", s.Properties["Node"])
+	}
+	if ref := s.Defs["schemaNode"].Properties["children"].Items.Ref; ref != "#/$defs/schemaNode" {
+		t.Errorf("unexpected recursive ref %q", ref)
+	}
+	if c := s.Properties["Count"]; c.Default != 3 || c.Minimum != "1" {
+		t.Errorf("unexpected Count schema %+v", c)
+	}
+}
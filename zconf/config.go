@@ -4,106 +4,116 @@ import (
 	"errors"
 	"io/fs"
 	"os"
-	"path"
 	"path/filepath"
-	"strings"
+	"reflect"
 
-	"github.com/spf13/viper"
 	"github.com/zzjcool/goutils/defaults"
-	"go.uber.org/zap"
 )
 
-// defaultConfig 获取默认配置
-func defaultConfig[T any](conf T) error {
-
-	err := defaults.Apply(conf)
+// defaultConfig 获取默认配置，设置了WithExpandEnv时default标签中的${VAR}会从环境变量中展开
+func defaultConfig(conf any, o *options) error {
+	var opts []defaults.Option
+	if o.expandEnv {
+		opts = append(opts, defaults.WithExpandEnv())
+	}
+	err := defaults.Apply(conf, opts...)
 	if err != nil {
 		return errors.Join(err, ErrSetDefaultValue)
 	}
 	return nil
 }
 
-type Logger interface {
-	Debug(args ...interface{})
-	Info(args ...interface{})
-	Debugf(template string, args ...interface{})
-	Infof(template string, args ...interface{})
-}
-
-var log Logger = zap.S()
-
-func SetLogger(l Logger) {
-	log = l
-}
-
-// Load 加载配置
-func Load[T any](conf T) error {
-	return LoadCustom(conf, "", "config.yml","", NewDeepFs(0))
+// Load 加载配置，默认在SearchPaths中查找config.yml，可以通过选项设置文件名、目录、环境和文件系统。
+// 需要多次加载时可以使用NewLoader
+func Load[T any](conf T, opts ...Option) error {
+	l, err := NewLoader(opts...)
+	if err != nil {
+		return err
+	}
+	return l.Load(conf)
 }
 
-func LoadWithDir[T any](conf T, dir string) error {
-	return LoadCustom(conf, "", "config.yml", dir, NewDeepFs(0))
+func LoadWithDir[T any](conf T, dir string, opts ...Option) error {
+	return Load(conf, append(opts, WithDir(dir))...)
 }
 
-func LoadWithEnv[T any](conf T, env string) error {
-	return LoadCustom(conf, env, "config.yml", "",NewDeepFs(0))
+func LoadWithEnv[T any](conf T, env string, opts ...Option) error {
+	return Load(conf, append(opts, WithEnv(env))...)
 }
 
-func LoadCustom[T any](conf T, env, configFile, dir string, cfs fs.FS) error {
-	defaultConfig(conf)
-	return load(conf, env, configFile, dir, cfs)
+// LoadCustom 加载配置，加载完成后会使用vtor校验配置，可以通过WithoutValidate关闭
+func LoadCustom[T any](conf T, env, configFile, dir string, cfs fs.FS, opts ...Option) error {
+	return Load(conf, append(opts, WithEnv(env), WithConfigFile(configFile), WithDir(dir), WithFS(cfs))...)
 }
 
-func load[T any](conf T, env, configFile, dir string, confFs fs.FS) error {
-	var vp *viper.Viper
+// load 按顺序合并各层配置后一次性解析到conf中，后面的层覆盖前面的层：
+// WithEmbed添加的默认配置、配置文件、环境对应的配置文件、WithFiles添加的配置文件、环境变量、
+// WithOverride设置的值、命令行参数
+func load(conf any, o *options) error {
+	var flags *flagLayer
+	if o.flags {
+		var err error
+		if flags, err = parseFlags(reflect.TypeOf(conf), o); err != nil {
+			return err
+		}
+		o = flags.apply(o)
+	}
 
-	if err := loadConfig(vp, configFile, dir, conf, confFs); err != nil {
+	l := newLayers(o)
+	for _, file := range o.embedFiles {
+		if err := l.mergeFrom(o.embedFS, file, LayerEmbed); err != nil {
+			return err
+		}
+	}
+	// 有内置的默认配置时，配置文件可以不存在
+	if err := l.mergeFile(o.configFile, LayerFile); err != nil &&
+		!(o.embedFS != nil && errors.Is(err, fs.ErrNotExist)) {
 		return err
 	}
-	if env != "" {
-		return loadConfig(vp, env+"."+configFile, dir, conf, confFs)
+	if o.env != "" {
+		if err := l.mergeFile(o.env+"."+o.configFile, LayerEnvFile); err != nil {
+			return err
+		}
 	}
-	return nil
-}
-
-func loadConfig[T any](v *viper.Viper, config string, dir string, conf T, confFs fs.FS) error {
-	log.Debugf("CONFIG File:%v\n", config)
-	if v == nil {
-		v = viper.New()
+	for _, file := range o.files {
+		if err := l.mergeFile(file, LayerExtraFile); err != nil {
+			return err
+		}
+	}
+	if err := l.mergeEnv(reflect.TypeOf(conf)); err != nil {
+		return err
+	}
+	l.mergeOverrides(o.overrides)
+	if flags != nil {
+		if err := l.mergeFlags(flags); err != nil {
+			return err
+		}
 	}
-	// 设置CONF前缀的env
-	v.SetEnvPrefix("CONF")
-	v.AutomaticEnv()
-	replacer := strings.NewReplacer(".", "_")
-	v.SetEnvKeyReplacer(replacer)
-
-	v.SetConfigFile(config)
-	rawConf, err := confFs.Open(path.Join(dir, config))
 
-	if err != nil {
-		log.Debug(err)
-		log.Debug("The config file is not loaded:", config)
-		return errors.Join(err, ErrOpenConfigFile)
+	if err := l.checkUnknown(reflect.TypeOf(conf)); err != nil {
+		return err
 	}
-	err = v.ReadConfig(rawConf)
-	if err != nil {
-		log.Debugf("read config error:%v", err)
-		return errors.Join(err, ErrInvalidConfigFile)
+	if err := l.v.Unmarshal(conf); err != nil {
+		o.log.Debug(err)
+		return unmarshalErrors(err, l.sources)
 	}
-	if err := v.Unmarshal(conf); err != nil {
-		log.Debug(err)
-		return errors.Join(err, ErrUnmarshalConfig)
+	if o.sources != nil {
+		l.mergeDefaults(reflect.TypeOf(conf))
+		*o.sources = l.sources
 	}
-
 	return nil
 }
 
 // NewDeepFs ...
+//
+// Deprecated: 使用NewSearchFs或WithSearchPaths
 func NewDeepFs(deep int) fs.FS {
 	return &DeepFs{Deep: deep}
 }
 
 // DeepFs 配置
+//
+// Deprecated: 使用SearchFs
 type DeepFs struct {
 	Deep int // 表示查找配置的目录深度，例如为1时，当前目录为/code/config/,这个时候配置的搜寻目录从/code/开始
 }
@@ -117,7 +127,5 @@ func (fs *DeepFs) Open(name string) (fs.File, error) {
 		deep--
 	}
 	file := filepath.Join(path, name)
-	log.Debugf("try to open file:", file)
 	return os.Open(file)
 }
-
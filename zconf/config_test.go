@@ -1,12 +1,24 @@
 package zconf_test
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/zzjcool/goutils/defaults"
+	"github.com/zzjcool/goutils/vtor"
 	"github.com/zzjcool/goutils/zconf"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 	"gotest.tools/assert"
 )
 
@@ -36,6 +48,10 @@ type ConfigTest struct {
 	Setting     int  `yaml:"setting"`
 }
 
+type ValidateConfigTest struct {
+	Port int `yaml:"port" vtor:"min=1"`
+}
+
 func TestConfig(t *testing.T) {
 
 	t.Run("Test default value", func(t *testing.T) {
@@ -67,6 +83,21 @@ func TestConfig(t *testing.T) {
 		assert.Equal(t, errors.Is(err, zconf.ErrInvalidConfigFile), true)
 	})
 
+	t.Run("Test validate config", func(t *testing.T) {
+
+		defer CreateTmpYamlFile(`port: 0`, "config.yml")()
+		conf := new(ValidateConfigTest)
+		err := zconf.Load(conf)
+		assert.Equal(t, errors.Is(err, zconf.ErrValidateConfig), true)
+
+		var verrs vtor.Errors
+		assert.Equal(t, errors.As(err, &verrs), true)
+		assert.Equal(t, verrs[0].Path, "Port")
+
+		err = zconf.Load(conf, zconf.WithoutValidate())
+		assert.NilError(t, err)
+	})
+
 	t.Run("Test yaml not exist", func(t *testing.T) {
 		conf := new(ConfigTest)
 		err := zconf.Load(conf)
@@ -74,3 +105,757 @@ func TestConfig(t *testing.T) {
 		assert.Equal(t, errors.Is(err, zconf.ErrOpenConfigFile), true)
 	})
 }
+
+type WatchConfigTest struct {
+	Name string `yaml:"name" default:"zconf"`
+	Port int    `yaml:"port" vtor:"min=1"`
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	file := dir + "/config.yml"
+	CreateTmpYamlFile(`port: 8080`, file)
+
+	conf := new(WatchConfigTest)
+	w, err := zconf.Watch(conf, zconf.WithDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	assert.Equal(t, w.Get(), conf)
+	assert.Equal(t, conf.Name, "zconf")
+
+	changed := make(chan [2]*WatchConfigTest, 1)
+	failed := make(chan error, 1)
+	w.OnChange(func(old, new *WatchConfigTest) { changed <- [2]*WatchConfigTest{old, new} })
+	w.OnError(func(err error) { failed <- err })
+
+	CreateTmpYamlFile(`port: 9090`, file)
+	select {
+	case c := <-changed:
+		assert.Equal(t, c[0].Port, 8080)
+		assert.Equal(t, c[1].Port, 9090)
+		assert.Equal(t, c[1].Name, "zconf")
+		assert.Equal(t, w.Get(), c[1])
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was not reloaded")
+	}
+
+	// 校验失败时保留之前的配置
+	CreateTmpYamlFile(`port: 0`, file)
+	select {
+	case err := <-failed:
+		assert.Equal(t, errors.Is(err, zconf.ErrValidateConfig), true)
+		assert.Equal(t, w.Get().Port, 9090)
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload error was not reported")
+	}
+}
+
+func TestWatchSearchPaths(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(dir+"/app", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	CreateTmpYamlFile(`port: 8080`, dir+"/app/config.yml")
+
+	conf := new(WatchConfigTest)
+	w, err := zconf.Watch(conf, zconf.WithSearchPaths(t.TempDir(), dir), zconf.WithDir("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, conf.Port, 8080)
+
+	changed := make(chan *WatchConfigTest, 1)
+	w.OnChange(func(old, new *WatchConfigTest) { changed <- new })
+	CreateTmpYamlFile(`port: 9090`, dir+"/app/config.yml")
+	select {
+	case c := <-changed:
+		assert.Equal(t, c.Port, 9090)
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was not reloaded")
+	}
+
+	// Close可以并发调用
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, w.Close(), nil)
+		}()
+	}
+	wg.Wait()
+
+	_, err = zconf.Watch(new(WatchConfigTest), zconf.WithFS(os.DirFS(dir)))
+	assert.Equal(t, err != nil, true)
+}
+
+type LayerConfigTest struct {
+	Name    string            `yaml:"name"`
+	Port    int               `yaml:"port"`
+	Debug   bool              `yaml:"debug"`
+	Hosts   []string          `yaml:"hosts"`
+	Labels  map[string]string `yaml:"labels"`
+	Timeout int               `yaml:"timeout"`
+}
+
+func TestLayers(t *testing.T) {
+	dir := t.TempDir()
+	CreateTmpYamlFile("name: base\nport: 80\nhosts: [a, b]\nlabels: {app: demo, tier: web}\n", dir+"/config.yml")
+	CreateTmpYamlFile("port: 8080\nlabels: {tier: api}\n", dir+"/dev.config.yml")
+	CreateTmpYamlFile("debug: true\ntimeout: 1\n", dir+"/local.yml")
+	t.Setenv("CONF_TIMEOUT", "30")
+
+	var sources zconf.Sources
+	conf := new(LayerConfigTest)
+	err := zconf.LoadCustom(conf, "dev", "config.yml", "", os.DirFS(dir),
+		zconf.WithFiles("local.yml"),
+		zconf.WithOverride("name", "override"),
+		zconf.WithSources(&sources))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.DeepEqual(t, conf, &LayerConfigTest{
+		Name:    "override",
+		Port:    8080,
+		Debug:   true,
+		Hosts:   []string{"a", "b"},
+		Labels:  map[string]string{"app": "demo", "tier": "api"},
+		Timeout: 30,
+	})
+
+	for key, expected := range map[string]zconf.Source{
+		"name":        {Layer: zconf.LayerOverride},
+		"port":        {Layer: zconf.LayerEnvFile, Name: "dev.config.yml", Line: 1},
+		"hosts":       {Layer: zconf.LayerFile, Name: "config.yml", Line: 3},
+		"labels.app":  {Layer: zconf.LayerFile, Name: "config.yml", Line: 4},
+		"labels.tier": {Layer: zconf.LayerEnvFile, Name: "dev.config.yml", Line: 2},
+		"debug":       {Layer: zconf.LayerExtraFile, Name: "local.yml", Line: 1},
+		"Timeout":     {Layer: zconf.LayerEnv, Name: "CONF_TIMEOUT"},
+	} {
+		src, ok := sources.Lookup(key)
+		assert.Equal(t, ok, true, key)
+		assert.Equal(t, src, expected, key)
+	}
+}
+
+type FormatConfigTest struct {
+	Name   string `yaml:"name"`
+	Port   int    `yaml:"port"`
+	Server struct {
+		Host string `yaml:"host"`
+		TLS  bool   `yaml:"tls"`
+	} `yaml:"server"`
+}
+
+func TestFormats(t *testing.T) {
+	dir := t.TempDir()
+	CreateTmpYamlFile("port = 8080\n[server]\nhost = \"example.com\"\n", dir+"/config.toml")
+	CreateTmpYamlFile("SERVER__TLS=true\n", dir+"/.env")
+	embedded := fstest.MapFS{
+		"defaults.json": {Data: []byte(`{"name": "embedded", "port": 80, "server": {"host": "localhost"}}`)},
+	}
+
+	var sources zconf.Sources
+	conf := new(FormatConfigTest)
+	err := zconf.Load(conf,
+		zconf.WithSearchPaths(dir+"/missing", dir),
+		zconf.WithConfigFile("config.toml"),
+		zconf.WithFiles(".env"),
+		zconf.WithEmbed(embedded, "defaults.json"),
+		zconf.WithSources(&sources))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, conf.Name, "embedded")
+	assert.Equal(t, conf.Port, 8080)
+	assert.Equal(t, conf.Server.Host, "example.com")
+	assert.Equal(t, conf.Server.TLS, true)
+	src, _ := sources.Lookup("name")
+	assert.Equal(t, src, zconf.Source{Layer: zconf.LayerEmbed, Name: "defaults.json", Line: 1})
+	src, _ = sources.Lookup("server.tls")
+	assert.Equal(t, src, zconf.Source{Layer: zconf.LayerExtraFile, Name: ".env", Line: 1})
+
+	// 有内置的默认配置时配置文件可以不存在
+	conf = new(FormatConfigTest)
+	err = zconf.Load(conf, zconf.WithFS(fstest.MapFS{}), zconf.WithEmbed(embedded, "defaults.json"))
+	assert.NilError(t, err)
+	assert.Equal(t, conf.Port, 80)
+
+	err = zconf.Load(conf, zconf.WithFS(fstest.MapFS{}))
+	assert.Equal(t, errors.Is(err, zconf.ErrOpenConfigFile), true)
+
+	err = zconf.Load(conf, zconf.WithFS(fstest.MapFS{"config.ini": {}}), zconf.WithConfigFile("config.ini"))
+	assert.Equal(t, errors.Is(err, zconf.ErrInvalidConfigFile), true)
+}
+
+type EnvConfigTest struct {
+	Name     string `yaml:"name"`
+	Password string `yaml:"password" env:"DB_PASSWORD"`
+	Server   struct {
+		Hosts   []string      `yaml:"hosts"`
+		Timeout time.Duration `yaml:"timeout"`
+	} `yaml:"server"`
+	Weights map[string]int `yaml:"weights"`
+}
+
+func TestEnv(t *testing.T) {
+	fsys := fstest.MapFS{"config.yml": {Data: []byte("name: file\nweights: {a: 1, b: 2}\n")}}
+	t.Setenv("APP_SERVER_HOSTS", "a.example.com,b.example.com")
+	t.Setenv("APP_SERVER_TIMEOUT", "1m30s")
+	t.Setenv("APP_WEIGHTS", "b:3")
+	t.Setenv("DB_PASSWORD", "secret")
+	t.Setenv("CONF_NAME", "ignored")
+
+	var sources zconf.Sources
+	conf := new(EnvConfigTest)
+	err := zconf.Load(conf, zconf.WithFS(fsys), zconf.WithEnvPrefix("APP"), zconf.WithSources(&sources))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, conf.Name, "file")
+	assert.Equal(t, conf.Password, "secret")
+	assert.DeepEqual(t, conf.Server.Hosts, []string{"a.example.com", "b.example.com"})
+	assert.Equal(t, conf.Server.Timeout, 90*time.Second)
+	assert.DeepEqual(t, conf.Weights, map[string]int{"a": 1, "b": 3})
+	src, _ := sources.Lookup("password")
+	assert.Equal(t, src, zconf.Source{Layer: zconf.LayerEnv, Name: "DB_PASSWORD"})
+
+	t.Setenv("APP_SERVER_TIMEOUT", "soon")
+	err = zconf.Load(new(EnvConfigTest), zconf.WithFS(fsys), zconf.WithEnvPrefix("APP"))
+	assert.Equal(t, errors.Is(err, zconf.ErrUnmarshalConfig), true)
+}
+
+type SecretConfigTest struct {
+	User     string            `yaml:"user"`
+	Password string            `yaml:"password" secret:"true"`
+	Token    string            `yaml:"token" secret:"true" default:"env://TEST_TOKEN"`
+	Keys     map[string]string `yaml:"keys" secret:"true"`
+	Hosts    []string          `yaml:"hosts" secret:"true"`
+	Backends []*struct {
+		Key string `yaml:"key" secret:"true" vtor:"min=8"`
+	} `yaml:"backends"`
+}
+
+func TestSecrets(t *testing.T) {
+	dir := t.TempDir()
+	CreateTmpYamlFile("hunter2\n", dir+"/db")
+	fsys := fstest.MapFS{"config.yml": {Data: []byte(
+		"user: file://" + dir + "/db-user\npassword: file://" + dir + "/db\n" +
+			"keys: {api: vault://secret/api}\nhosts: [a, vault://secret/host]\nbackends: [{key: vault://secret/backend}]\n",
+	)}}
+	CreateTmpYamlFile("admin", dir+"/db-user")
+	t.Setenv("TEST_TOKEN", "token")
+	vault := zconf.SecretResolverFunc(func(ref string) (string, error) {
+		return "vault:" + ref, nil
+	})
+
+	conf := new(SecretConfigTest)
+	err := zconf.Load(conf, zconf.WithFS(fsys), zconf.WithSecretResolver("vault", vault))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有secret标签的字段不会被解析
+	assert.Equal(t, conf.User, "file://"+dir+"/db-user")
+	assert.Equal(t, conf.Password, "hunter2")
+	assert.Equal(t, conf.Token, "token")
+	assert.Equal(t, conf.Keys["api"], "vault:secret/api")
+	assert.DeepEqual(t, conf.Hosts, []string{"a", "vault:secret/host"})
+	assert.Equal(t, conf.Backends[0].Key, "vault:secret/backend")
+
+	redacted := zconf.Redact(conf)
+	assert.Equal(t, redacted.User, conf.User)
+	assert.Equal(t, redacted.Password, zconf.Redacted)
+	assert.DeepEqual(t, redacted.Keys, map[string]string{"api": zconf.Redacted})
+	assert.DeepEqual(t, redacted.Hosts, []string{zconf.Redacted, zconf.Redacted})
+	assert.Equal(t, conf.Hosts[0], "a")
+	assert.Equal(t, redacted.Backends[0].Key, zconf.Redacted)
+	assert.Equal(t, conf.Password, "hunter2")
+	assert.Equal(t, conf.Backends[0].Key, "vault:secret/backend")
+	assert.Equal(t, strings.Contains(fmt.Sprintf("%+v", *redacted), "hunter2"), false)
+
+	// 未注册的scheme不会被解析
+	err = zconf.Load(new(SecretConfigTest), zconf.WithFS(fsys))
+	assert.Equal(t, err, nil)
+
+	// 校验错误中不包含secret字段的值
+	vault = func(ref string) (string, error) { return "short", nil }
+	err = zconf.Load(new(SecretConfigTest), zconf.WithFS(fsys), zconf.WithSecretResolver("vault", vault))
+	var fe *vtor.FieldError
+	assert.Equal(t, errors.As(err, &fe), true)
+	assert.Equal(t, fe.Path, "Backends[0].Key")
+	assert.Equal(t, fe.Value, zconf.Redacted)
+
+	t.Setenv("TEST_TOKEN", "")
+	os.Unsetenv("TEST_TOKEN")
+	err = zconf.Load(new(SecretConfigTest), zconf.WithFS(fsys))
+	assert.Equal(t, errors.Is(err, zconf.ErrResolveSecret), true)
+}
+
+func TestSecretStructs(t *testing.T) {
+	type DB struct {
+		User     string                  `yaml:"user"`
+		Password string                  `yaml:"password" vtor:"min=20"`
+		Port     int                     `yaml:"port"`
+		Replicas []*struct{ DSN string } `yaml:"replicas"`
+		Options  map[string]string       `yaml:"options"`
+	}
+	type config struct {
+		DB DB `yaml:"db" secret:"true"`
+	}
+	fsys := fstest.MapFS{"config.yml": {Data: []byte(
+		"db: {user: admin, password: hunter2, port: 5432, replicas: [{dsn: vault://replica}], options: {sslkey: vault://key}}\n",
+	)}}
+	vault := zconf.SecretResolverFunc(func(ref string) (string, error) {
+		return "vault:" + ref, nil
+	})
+
+	// 校验错误中不包含secret结构体中字段的值
+	conf := new(config)
+	err := zconf.Load(conf, zconf.WithFS(fsys), zconf.WithSecretResolver("vault", vault))
+	var fe *vtor.FieldError
+	assert.Equal(t, errors.As(err, &fe), true)
+	assert.Equal(t, fe.Path, "DB.Password")
+	assert.Equal(t, fe.Value, zconf.Redacted)
+	assert.Equal(t, strings.Contains(err.Error(), "hunter2"), false)
+
+	// secret结构体中的字符串都会被替换，其他类型设置为零值
+	assert.Equal(t, conf.DB.Replicas[0].DSN, "vault:replica")
+	redacted := zconf.Redact(conf)
+	assert.Equal(t, redacted.DB.User, zconf.Redacted)
+	assert.Equal(t, redacted.DB.Password, zconf.Redacted)
+	assert.Equal(t, redacted.DB.Port, 0)
+	assert.Equal(t, redacted.DB.Replicas[0].DSN, zconf.Redacted)
+	assert.DeepEqual(t, redacted.DB.Options, map[string]string{"sslkey": zconf.Redacted})
+	assert.Equal(t, conf.DB.Password, "hunter2")
+	assert.Equal(t, conf.DB.Replicas[0].DSN, "vault:replica")
+}
+
+type FlagConfigTest struct {
+	Debug  bool `yaml:"debug" usage:"enable debug logs"`
+	Server struct {
+		Port    int           `yaml:"port" default:"80" usage:"listen port"`
+		Hosts   []string      `yaml:"hosts"`
+		Timeout time.Duration `yaml:"timeout"`
+	} `yaml:"server"`
+}
+
+func TestFlags(t *testing.T) {
+	dir := t.TempDir()
+	CreateTmpYamlFile("server: {port: 8080, timeout: 1s}\n", dir+"/app.yml")
+	CreateTmpYamlFile("server: {hosts: [dev]}\n", dir+"/dev.app.yml")
+	t.Setenv("CONF_SERVER_PORT", "8081")
+
+	var sources zconf.Sources
+	conf := new(FlagConfigTest)
+	err := zconf.Load(conf, zconf.WithSources(&sources), zconf.WithArgs([]string{
+		"--config", dir + "/app.yml", "--env=dev", "--debug",
+		"--server.port", "9090", "--server.hosts", "a", "--server.hosts", "b",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, conf.Debug, true)
+	assert.Equal(t, conf.Server.Port, 9090)
+	assert.DeepEqual(t, conf.Server.Hosts, []string{"a", "b"})
+	assert.Equal(t, conf.Server.Timeout, time.Second)
+	src, _ := sources.Lookup("server.port")
+	assert.Equal(t, src, zconf.Source{Layer: zconf.LayerFlag, Name: "--server.port"})
+
+	err = zconf.Load(new(FlagConfigTest), zconf.WithArgs([]string{"--config", dir + "/app.yml", "--server.port=x"}))
+	assert.Equal(t, errors.Is(err, zconf.ErrParseFlags), true)
+
+	err = zconf.Load(new(FlagConfigTest), zconf.WithArgs([]string{"--unknown"}))
+	assert.Equal(t, errors.Is(err, zconf.ErrParseFlags), true)
+}
+
+type flagLevel struct {
+	N int
+}
+
+func TestFlagsLeafTypes(t *testing.T) {
+	defaults.RegisterParser(reflect.TypeOf(flagLevel{}), func(s string) (any, error) {
+		n, err := strconv.Atoi(s)
+		return flagLevel{N: n}, err
+	})
+	defer defaults.RegisterParser(reflect.TypeOf(flagLevel{}), nil)
+	type config struct {
+		Level    flagLevel `yaml:"level"`
+		OnChange func()    `yaml:"onchange"`
+		Events   chan int  `yaml:"events"`
+		Extra    any       `yaml:"extra"`
+	}
+	fsys := fstest.MapFS{"config.yml": {Data: []byte("\n")}}
+
+	// 注册了解析函数的类型作为一个参数，不会展开其中的字段
+	conf := new(config)
+	err := zconf.Load(conf, zconf.WithFS(fsys), zconf.WithArgs([]string{"--level", "3"}))
+	assert.NilError(t, err)
+	assert.Equal(t, conf.Level.N, 3)
+	err = zconf.Load(new(config), zconf.WithFS(fsys), zconf.WithArgs([]string{"--level.n", "3"}))
+	assert.Equal(t, strings.Contains(err.Error(), "unknown flag"), true, err.Error())
+
+	// 函数、channel和interface字段没有对应的参数
+	for _, flag := range []string{"--onchange", "--events", "--extra"} {
+		err = zconf.Load(new(config), zconf.WithFS(fsys), zconf.WithArgs([]string{flag, "x"}))
+		assert.Equal(t, errors.Is(err, zconf.ErrParseFlags), true, flag)
+		assert.Equal(t, strings.Contains(err.Error(), "unknown flag"), true, err.Error())
+	}
+}
+
+type DumpConfigTest struct {
+	Debug    bool   `yaml:"debug"`
+	Password string `yaml:"password" secret:"true"`
+	Server   struct {
+		Port    int           `yaml:"port" default:"80"`
+		Timeout time.Duration `yaml:"timeout"`
+		Hosts   []string      `yaml:"hosts"`
+	} `yaml:"server"`
+}
+
+func TestDump(t *testing.T) {
+	fsys := fstest.MapFS{"config.yml": {Data: []byte("password: hunter2\nserver:\n  timeout: 1s\n  hosts: [a, b]\n")}}
+	t.Setenv("CONF_DEBUG", "true")
+
+	var sources zconf.Sources
+	conf := new(DumpConfigTest)
+	if err := zconf.Load(conf, zconf.WithFS(fsys), zconf.WithSources(&sources)); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := zconf.Dump(conf, zconf.WithDumpSources(sources))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `debug: true # env CONF_DEBUG
+password: '******' # file config.yml:1
+server:
+  port: 80 # default "80"
+  timeout: 1s # file config.yml:3
+  hosts: # file config.yml:4
+    - a
+    - b
+`)
+
+	b, err = zconf.Dump(conf, zconf.WithDumpFormat(zconf.FormatJSON))
+	assert.NilError(t, err)
+	var v map[string]any
+	assert.NilError(t, json.Unmarshal(b, &v))
+	assert.DeepEqual(t, v, map[string]any{
+		"debug":    true,
+		"password": zconf.Redacted,
+		"server":   map[string]any{"port": float64(80), "timeout": "1s", "hosts": []any{"a", "b"}},
+	})
+
+	// 输出的YAML可以重新加载
+	b, _ = zconf.Dump(conf)
+	reloaded := new(DumpConfigTest)
+	err = zconf.Load(reloaded, zconf.WithFS(fstest.MapFS{"config.yml": {Data: b}}))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, reloaded.Server, conf.Server)
+}
+
+func TestLoadError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.yml":  {Data: []byte("name: app\nserver:\n  port: abc\n")},
+		"bad.yml":     {Data: []byte("name: app\n  port: 1\n")},
+		"config.json": {Data: []byte("{\n  \"name\": \"app\",\n  \"port\" 80\n}")},
+	}
+	type server struct {
+		Port int `yaml:"port"`
+	}
+	type config struct {
+		Name   string `yaml:"name"`
+		Server server `yaml:"server"`
+	}
+
+	var le *zconf.LoadError
+	err := zconf.Load(new(config), zconf.WithFS(fsys))
+	assert.Equal(t, errors.Is(err, zconf.ErrUnmarshalConfig), true)
+	assert.Equal(t, errors.As(err, &le), true)
+	assert.Equal(t, le.File, "config.yml")
+	assert.Equal(t, le.Line, 3)
+	assert.Equal(t, le.Field, "Server.Port")
+	assert.Equal(t, le.Key, "server.port")
+	assert.Equal(t, le.Expected, "int")
+	assert.Equal(t, strings.HasPrefix(le.Error(), "config.yml:3: Server.Port: expected int"), true, le.Error())
+
+	err = zconf.Load(new(config), zconf.WithFS(fsys), zconf.WithConfigFile("bad.yml"))
+	assert.Equal(t, errors.Is(err, zconf.ErrInvalidConfigFile), true)
+	assert.Equal(t, errors.As(err, &le), true)
+	assert.Equal(t, le.File, "bad.yml")
+	assert.Equal(t, le.Line, 2)
+
+	err = zconf.Load(new(config), zconf.WithFS(fsys), zconf.WithConfigFile("config.json"))
+	assert.Equal(t, errors.Is(err, zconf.ErrInvalidConfigFile), true)
+	assert.Equal(t, errors.As(err, &le), true)
+	assert.Equal(t, le.Line, 3)
+	assert.Equal(t, le.Column, 10)
+
+	err = zconf.Load(new(config), zconf.WithFS(fsys), zconf.WithConfigFile("missing.yml"))
+	assert.Equal(t, errors.Is(err, zconf.ErrOpenConfigFile), true)
+	assert.Equal(t, errors.Is(err, fs.ErrNotExist), true)
+}
+
+type recordLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *recordLogger) Debug(args ...interface{}) { l.add(fmt.Sprint(args...)) }
+func (l *recordLogger) Info(args ...interface{})  { l.add(fmt.Sprint(args...)) }
+func (l *recordLogger) Debugf(template string, args ...interface{}) {
+	l.add(fmt.Sprintf(template, args...))
+}
+func (l *recordLogger) Infof(template string, args ...interface{}) {
+	l.add(fmt.Sprintf(template, args...))
+}
+
+func (l *recordLogger) add(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, msg)
+}
+
+func TestLoader(t *testing.T) {
+	errTooSmall := errors.New("port is too small")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			log := &recordLogger{}
+			fsys := fstest.MapFS{"config.yml": {Data: []byte(fmt.Sprintf("port: %d\n", port))}}
+			loader, err := zconf.NewLoader(
+				zconf.WithFS(fsys),
+				zconf.WithLogger(log),
+				zconf.WithValidators(func(conf any) error {
+					if conf.(*ValidateConfigTest).Port < 2 {
+						return errTooSmall
+					}
+					return nil
+				}),
+			)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			conf := new(ValidateConfigTest)
+			err = loader.Load(conf)
+			if port < 2 {
+				if !errors.Is(err, errTooSmall) || !errors.Is(err, zconf.ErrValidateConfig) {
+					t.Errorf("expected validator error, got %v", err)
+				}
+				if len(log.logs) == 0 {
+					t.Errorf("expected the error to be logged")
+				}
+				return
+			}
+			if err != nil || conf.Port != port {
+				t.Errorf("unexpected %+v, %v", conf, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestLoaderGlobalLogger(t *testing.T) {
+	fsys := fstest.MapFS{"config.yml": {Data: []byte("port: 8080\nprot: 8080\n")}}
+	loader, err := zconf.NewLoader(zconf.WithFS(fsys), zconf.WithWarnUnknown())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有WithLogger时使用加载时的zap.S()
+	core, logs := observer.New(zap.InfoLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+	if err := loader.Load(new(ValidateConfigTest)); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, logs.FilterMessageSnippet("prot").Len(), 1)
+}
+
+func TestMigrations(t *testing.T) {
+	migrations := zconf.NewMigrations().
+		Register(1, func(m *zconf.Map) error {
+			m.Move("listen", "server.port")
+			return nil
+		}).
+		Register(2, func(m *zconf.Map) error {
+			m.Delete("debug")
+			return nil
+		})
+	assert.Equal(t, migrations.Latest(), 3)
+
+	type server struct {
+		Port int `yaml:"port"`
+	}
+	type config struct {
+		Version int    `yaml:"version"`
+		Name    string `yaml:"name"`
+		Server  server `yaml:"server"`
+	}
+
+	old := "# app config\nname: app # the name\nshowLine: true # keep\ndebug: true\n# listen port\nlisten: 8080\n"
+	fsys := fstest.MapFS{
+		"config.yml": {Data: []byte(old)},
+		"new.yml":    {Data: []byte("version: 3\nserver:\n  port: 9090\n")},
+		"future.yml": {Data: []byte("version: 4\n")},
+	}
+	conf := new(config)
+	sources := zconf.Sources{}
+	err := zconf.Load(conf, zconf.WithFS(fsys), zconf.WithMigrations(migrations), zconf.WithSources(&sources))
+	assert.NilError(t, err)
+	assert.Equal(t, *conf, config{Version: 3, Name: "app", Server: server{Port: 8080}})
+	assert.Equal(t, sources["server.port"].Line, 6)
+
+	conf = new(config)
+	err = zconf.Load(conf, zconf.WithFS(fsys), zconf.WithConfigFile("new.yml"), zconf.WithMigrations(migrations))
+	assert.NilError(t, err)
+	assert.Equal(t, conf.Server.Port, 9090)
+
+	err = zconf.Load(new(config), zconf.WithFS(fsys), zconf.WithConfigFile("future.yml"), zconf.WithMigrations(migrations))
+	assert.Equal(t, errors.Is(err, zconf.ErrMigrateConfig), true)
+
+	path := t.TempDir() + "/config.yml"
+	assert.NilError(t, os.WriteFile(path, []byte(old), 0o600))
+	changed, err := zconf.MigrateFile(path, migrations)
+	assert.NilError(t, err)
+	assert.Equal(t, changed, true)
+	data, err := os.ReadFile(path)
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), "# app config\nname: app # the name\nshowLine: true # keep\n"+
+		"server:\n  # listen port\n  port: 8080\nversion: 3\n")
+
+	changed, err = zconf.MigrateFile(path, migrations)
+	assert.NilError(t, err)
+	assert.Equal(t, changed, false)
+
+	jsonPath := t.TempDir() + "/config.json"
+	assert.NilError(t, os.WriteFile(jsonPath, []byte(`{"showLine": true, "listen": 80}`), 0o600))
+	_, err = zconf.MigrateFile(jsonPath, migrations)
+	assert.NilError(t, err)
+	data, err = os.ReadFile(jsonPath)
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), "{\n  \"server\": {\n    \"port\": 80\n  },\n  \"showLine\": true,\n  \"version\": 3\n}\n")
+}
+
+func TestMigrationsOverlay(t *testing.T) {
+	// 版本1的timeout为秒数，版本2改为时间格式，版本3将listen改为server.port
+	migrations := zconf.NewMigrations().
+		Register(1, func(m *zconf.Map) error {
+			if v, ok := m.Get("timeout"); ok {
+				m.Set("timeout", fmt.Sprint(v)+"s")
+			}
+			return nil
+		}).
+		Register(2, func(m *zconf.Map) error {
+			m.Move("listen", "server.port")
+			return nil
+		})
+	type config struct {
+		Timeout time.Duration `yaml:"timeout"`
+		Server  struct {
+			Port int `yaml:"port"`
+		} `yaml:"server"`
+	}
+
+	fsys := fstest.MapFS{
+		"config.yml":     {Data: []byte("version: 2\nlisten: 80\ntimeout: 5s\n")},
+		"dev.config.yml": {Data: []byte("timeout: 10s\nlisten: 8080\n")},
+		"embed.yml":      {Data: []byte("timeout: 1s\n")},
+	}
+	conf := new(config)
+	err := zconf.Load(conf, zconf.WithFS(fsys), zconf.WithEnv("dev"), zconf.WithEmbed(fsys, "embed.yml"),
+		zconf.WithMigrations(migrations))
+	assert.NilError(t, err)
+	assert.Equal(t, conf.Timeout, 10*time.Second)
+	assert.Equal(t, conf.Server.Port, 8080)
+}
+
+func TestStrict(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.yml": {Data: []byte("name: app\nserver:\n  prot: 8080\nlabels:\n  team: a\nzzz: 1\n")},
+	}
+	type server struct {
+		Port int `yaml:"port"`
+	}
+	type config struct {
+		Name   string            `yaml:"name"`
+		Server server            `yaml:"server"`
+		Labels map[string]string `yaml:"labels"`
+	}
+
+	err := zconf.Load(new(config), zconf.WithFS(fsys))
+	assert.NilError(t, err)
+
+	err = zconf.Load(new(config), zconf.WithFS(fsys), zconf.WithStrict())
+	assert.Equal(t, errors.Is(err, zconf.ErrUnknownKey), true)
+	var le *zconf.LoadError
+	assert.Equal(t, errors.As(err, &le), true)
+	assert.Equal(t, le.Key, "server.prot")
+	assert.Equal(t, le.Line, 3)
+	assert.Equal(t, err.Error(), "config.yml:3: server.prot: unknown key, did you mean server.port?\n"+
+		"config.yml:6: zzz: unknown config key")
+
+	log := &recordLogger{}
+	conf := new(config)
+	err = zconf.Load(conf, zconf.WithFS(fsys), zconf.WithWarnUnknown(), zconf.WithLogger(log))
+	assert.NilError(t, err)
+	assert.Equal(t, conf.Labels["team"], "a")
+	assert.Equal(t, strings.Contains(strings.Join(log.logs, "\n"), "did you mean server.port?"), true)
+}
+
+func TestStrictLists(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.yml": {Data: []byte("servers:\n  - name: a\n    port: 80\n  - name: b\n    prot: 81\n" +
+			"    tls: {cert: a.pem, kye: a.key}\n    routes: [{path: /, backnd: x}]\nports: [80]\n")},
+	}
+	type route struct {
+		Path    string `yaml:"path"`
+		Backend string `yaml:"backend"`
+	}
+	type server struct {
+		Name string `yaml:"name"`
+		Port int    `yaml:"port"`
+		TLS  struct {
+			Cert string `yaml:"cert"`
+			Key  string `yaml:"key"`
+		} `yaml:"tls"`
+		Routes []route `yaml:"routes"`
+	}
+	type config struct {
+		Servers []*server `yaml:"servers"`
+		Ports   []int     `yaml:"ports"`
+	}
+
+	err := zconf.Load(new(config), zconf.WithFS(fsys), zconf.WithStrict())
+	assert.Equal(t, errors.Is(err, zconf.ErrUnknownKey), true)
+	assert.Equal(t, err.Error(), "config.yml:1: servers[1].prot: unknown key, did you mean servers[1].port?\n"+
+		"config.yml:1: servers[1].routes[0].backnd: unknown key, did you mean servers[1].routes[0].backend?\n"+
+		"config.yml:1: servers[1].tls.kye: unknown key, did you mean servers[1].tls.key?")
+}
+
+func TestDefaultsExpandEnv(t *testing.T) {
+	type config struct {
+		Port int    `default:"${ZCONF_TEST_PORT:?port required}"`
+		Dir  string `default:"${ZCONF_TEST_DIR:-/tmp}"`
+	}
+	fsys := fstest.MapFS{"config.yml": {Data: []byte("\n")}}
+
+	// 没有WithExpandEnv时不展开环境变量，${VAR}不是合法的端口
+	err := zconf.Load(new(config), zconf.WithFS(fsys))
+	assert.Equal(t, errors.Is(err, zconf.ErrSetDefaultValue), true)
+	assert.Equal(t, errors.Is(err, defaults.ErrUnresolvedVariable), false, err.Error())
+
+	err = zconf.Load(new(config), zconf.WithFS(fsys), zconf.WithExpandEnv())
+	assert.Equal(t, errors.Is(err, zconf.ErrSetDefaultValue), true)
+	assert.Equal(t, errors.Is(err, defaults.ErrUnresolvedVariable), true, err.Error())
+	assert.Equal(t, strings.Contains(err.Error(), "port required"), true, err.Error())
+
+	t.Setenv("ZCONF_TEST_PORT", "8080")
+	conf := new(config)
+	assert.NilError(t, zconf.Load(conf, zconf.WithFS(fsys), zconf.WithExpandEnv()))
+	assert.Equal(t, *conf, config{Port: 8080, Dir: "/tmp"})
+}
@@ -0,0 +1,235 @@
+package zconf
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zzjcool/goutils/internal/reflectx"
+	"github.com/zzjcool/goutils/zoption"
+	"gopkg.in/yaml.v3"
+)
+
+// DumpOption 输出配置的选项
+type DumpOption = zoption.Option[*dumpOptions]
+
+type dumpOptions struct {
+	format  Format
+	sources Sources // 不为空时标注每个配置项的来源
+}
+
+// WithDumpFormat 设置输出的格式，支持FormatYAML和FormatJSON，默认为FormatYAML
+func WithDumpFormat(format Format) DumpOption {
+	return zoption.FuncOption[*dumpOptions](func(o *dumpOptions) error {
+		if format != FormatYAML && format != FormatJSON {
+			return fmt.Errorf("unsupported dump format %q", format)
+		}
+		o.format = format
+		return nil
+	})
+}
+
+// WithDumpSources 标注每个配置项的来源，sources通过加载时的WithSources获取。
+// YAML中来源写在注释中，JSON中每个配置项输出为{"value": 值, "source": 来源}
+func WithDumpSources(sources Sources) DumpOption {
+	return zoption.FuncOption[*dumpOptions](func(o *dumpOptions) error {
+		o.sources = sources
+		return nil
+	})
+}
+
+// Dump 输出当前生效的配置，带有`secret:"true"`标签的字段会被替换为Redacted。
+// 配置项的名称和加载时相同，输出的YAML可以直接作为配置文件使用
+func Dump(conf any, opts ...DumpOption) ([]byte, error) {
+	o := &dumpOptions{format: FormatYAML}
+	if err := zoption.Build(o, opts...); err != nil {
+		return nil, err
+	}
+
+	d := &dumper{sources: o.sources, json: o.format == FormatJSON}
+	node := d.node(reflect.ValueOf(Redact(conf)), "", nil)
+
+	if o.format == FormatJSON {
+		var v any
+		if err := node.Decode(&v); err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(v, "", "  ")
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// dumper 将配置转换为yaml.Node，保留结构体字段的顺序
+type dumper struct {
+	sources Sources
+	json    bool
+}
+
+var (
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	urlType           = reflect.TypeOf(url.URL{})
+)
+
+// node 转换v，key为v对应的配置项，stack用于避免循环引用
+func (d *dumper) node(v reflect.Value, key string, stack []uintptr) *yaml.Node {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return d.leaf(scalar("!!null", "null"), key)
+		}
+		if v.Kind() == reflect.Ptr {
+			for _, p := range stack {
+				if p == v.Pointer() {
+					return d.leaf(scalar("!!null", "null"), key)
+				}
+			}
+			stack = append(stack, v.Pointer())
+		}
+		v = v.Elem()
+	}
+
+	switch t := v.Type(); {
+	case t == reflectx.DurationType:
+		return d.leaf(scalar("!!str", time.Duration(v.Int()).String()), key)
+	case t == urlType:
+		u := v.Interface().(url.URL)
+		return d.leaf(scalar("!!str", u.String()), key)
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		c := reflect.New(t)
+		c.Elem().Set(v)
+		text, err := c.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			text = []byte(fmt.Sprint(v.Interface()))
+		}
+		return d.leaf(scalar("!!str", string(text)), key)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return d.leaf(scalar("!!bool", strconv.FormatBool(v.Bool())), key)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return d.leaf(scalar("!!int", strconv.FormatInt(v.Int(), 10)), key)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return d.leaf(scalar("!!int", strconv.FormatUint(v.Uint(), 10)), key)
+	case reflect.Float32, reflect.Float64:
+		return d.leaf(scalar("!!float", strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())), key)
+	case reflect.String:
+		return d.leaf(scalar("!!str", v.String()), key)
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return d.leaf(scalar("!!str", string(v.Bytes())), key)
+		}
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for i := 0; i < v.Len(); i++ {
+			// 切片中的元素没有单独的来源
+			seq.Content = append(seq.Content, (&dumper{json: d.json}).node(v.Index(i), "", stack))
+		}
+		return d.leaf(seq, key)
+
+	case reflect.Map:
+		m := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, k := range keys {
+			name := fmt.Sprint(k)
+			m.Content = append(m.Content, pair(name, d.node(v.MapIndex(k), reflectx.JoinPath(key, strings.ToLower(name)), stack))...)
+		}
+		return m
+
+	case reflect.Struct:
+		m := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		d.fields(m, v, key, stack)
+		return m
+
+	default:
+		return d.leaf(scalar("!!null", "null"), key)
+	}
+}
+
+// fields 将结构体的字段添加到m中，mapstructure标签为squash的嵌入结构体的字段属于外层结构体
+func (d *dumper) fields(m *yaml.Node, v reflect.Value, key string, stack []uintptr) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, squash := fieldKey(field)
+		if name == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if squash {
+			for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				d.fields(m, fv, key, stack)
+			}
+			continue
+		}
+		m.Content = append(m.Content, pair(name, d.node(fv, reflectx.JoinPath(key, name), stack))...)
+	}
+}
+
+// leaf 标注配置项的来源
+func (d *dumper) leaf(node *yaml.Node, key string) *yaml.Node {
+	src, ok := d.source(key)
+	if !ok {
+		return node
+	}
+	if d.json {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+			scalar("!!str", "value"), node,
+			scalar("!!str", "source"), scalar("!!str", src.String()),
+		}}
+	}
+	node.LineComment = src.String()
+	return node
+}
+
+// source 获取配置项的来源，没有记录时使用最近的上级配置项的来源，例如WithOverride设置的整个map
+func (d *dumper) source(key string) (Source, bool) {
+	if d.sources == nil || key == "" {
+		return Source{}, false
+	}
+	for {
+		if src, ok := d.sources[key]; ok {
+			return src, true
+		}
+		i := strings.LastIndex(key, ".")
+		if i < 0 {
+			return Source{}, false
+		}
+		key = key[:i]
+	}
+}
+
+// pair 返回map中的key和value，切片的来源写在key后面，否则会出现在下一行
+func pair(name string, value *yaml.Node) []*yaml.Node {
+	key := scalar("!!str", name)
+	if value.Kind != yaml.ScalarNode {
+		key.LineComment, value.LineComment = value.LineComment, ""
+	}
+	return []*yaml.Node{key, value}
+}
+
+func scalar(tag, value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
@@ -0,0 +1,182 @@
+package zconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/zzjcool/goutils/defaults"
+	"github.com/zzjcool/goutils/internal/reflectx"
+)
+
+// DefaultEnvPrefix 默认的环境变量前缀，例如server.port对应CONF_SERVER_PORT
+const DefaultEnvPrefix = "CONF"
+
+var envKeyReplacer = strings.NewReplacer(".", "_")
+
+// envBinding 配置项和环境变量的对应关系
+type envBinding struct {
+	key  string       // 小写的点分路径，例如server.port
+	name string       // 环境变量名
+	typ  reflect.Type // 字段的类型，为nil时使用字符串
+}
+
+// mergeEnv 读取配置结构体中每个字段以及配置文件中每个配置项对应的环境变量，
+// 按字段的类型解析后合并到配置文件之上。字段可以通过env标签指定环境变量名，例如`env:"DB_PASSWORD"`。
+func (l *layers) mergeEnv(t reflect.Type) error {
+	var bindings []envBinding
+	bound := map[string]bool{}
+	walkFields(t, func(key string, field reflect.StructField, ft reflect.Type) {
+		name := field.Tag.Get("env")
+		if name == "" {
+			name = l.envVar(key)
+		}
+		bindings = append(bindings, envBinding{key: key, name: name, typ: ft})
+		bound[key] = true
+	})
+	// 配置文件中结构体之外的配置项，例如map中的key
+	for _, key := range l.v.AllKeys() {
+		if !bound[key] {
+			bindings = append(bindings, envBinding{key: key, name: l.envVar(key)})
+		}
+	}
+
+	settings := map[string]any{}
+	for _, b := range bindings {
+		raw, ok := os.LookupEnv(b.name)
+		if !ok || raw == "" {
+			continue
+		}
+		value, err := parseValue(b.typ, raw)
+		if err != nil {
+			return &LoadError{Key: b.key, Expected: typeName(b.typ), Actual: "env " + b.name,
+				Kind: ErrUnmarshalConfig, Err: err}
+		}
+		setNested(settings, b.key, value)
+		l.sources[b.key] = Source{Layer: LayerEnv, Name: b.name}
+	}
+	if len(settings) == 0 {
+		return nil
+	}
+	return l.v.MergeConfigMap(settings)
+}
+
+// walkFields 遍历结构体中所有的叶子字段，key为字段对应的配置项，和viper解析时一样使用mapstructure标签，
+// 结构体字段会被展开，time.Time等以文本表示的结构体作为叶子字段
+func walkFields(t reflect.Type, fn func(key string, field reflect.StructField, ft reflect.Type)) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		walkStruct(t, "", []reflect.Type{t}, fn)
+	}
+}
+
+func walkStruct(t reflect.Type, key string, stack []reflect.Type, fn func(string, reflect.StructField, reflect.Type)) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, squash := fieldKey(field)
+		if name == "-" {
+			continue
+		}
+		fieldKey := key
+		if !squash {
+			fieldKey = reflectx.JoinPath(key, name)
+		}
+
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && !reflectx.IsText(ft) {
+			if !reflectx.OnStack(stack, ft) {
+				walkStruct(ft, fieldKey, append(stack, ft), fn) // recurse
+			}
+			continue
+		}
+		fn(fieldKey, field, ft)
+	}
+}
+
+// envVar 获取配置项对应的环境变量名
+func (l *layers) envVar(key string) string {
+	name := strings.ToUpper(envKeyReplacer.Replace(key))
+	if l.opts.envPrefix == "" {
+		return name
+	}
+	return l.opts.envPrefix + "_" + name
+}
+
+// fieldKey 获取字段对应的配置项名，squash表示嵌入的结构体的字段属于外层结构体
+func fieldKey(field reflect.StructField) (name string, squash bool) {
+	tag := field.Tag.Get("mapstructure")
+	name, opts, _ := strings.Cut(tag, ",")
+	if strings.Contains(opts, "squash") {
+		return "", true
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return strings.ToLower(name), false
+}
+
+// parseValue 按字段的类型解析环境变量或命令行参数，切片和map支持逗号分隔和JSON格式，
+// 元素为结构体时需要使用JSON格式
+func parseValue(t reflect.Type, raw string) (any, error) {
+	if t == nil || t.Kind() == reflect.String {
+		return raw, nil
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		elem := t.Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() == reflect.Struct && !reflectx.IsText(elem) {
+			var v any
+			err := json.Unmarshal([]byte(raw), &v)
+			return v, err
+		}
+	}
+
+	v, err := defaults.Parse(t, raw)
+	if err != nil {
+		return nil, err
+	}
+	if t.Kind() == reflect.Map {
+		// 和配置文件中的map合并
+		m := map[string]any{}
+		iter := reflect.ValueOf(v).MapRange()
+		for iter.Next() {
+			m[strings.ToLower(fmt.Sprint(iter.Key()))] = iter.Value().Interface()
+		}
+		return m, nil
+	}
+	return v, nil
+}
+
+func typeName(t reflect.Type) string {
+	if t == nil {
+		return "string"
+	}
+	return t.String()
+}
+
+// setNested 将点分路径的配置项设置到嵌套的map中
+func setNested(m map[string]any, key string, value any) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := m[part].(map[string]any)
+		if !ok {
+			child = map[string]any{}
+			m[part] = child
+		}
+		m = child
+	}
+	m[parts[len(parts)-1]] = value
+}
@@ -8,4 +8,9 @@ var(
 	ErrOpenConfigFile   = errors.New("file does not exist or is corrupted")
 	ErrInvalidConfigFile   = errors.New("invalid config content format")
 	ErrUnmarshalConfig  = errors.New("unmarshal config error")
+	ErrValidateConfig   = errors.New("validate config error")
+	ErrResolveSecret    = errors.New("resolve secret error")
+	ErrParseFlags       = errors.New("parse flags error")
+	ErrMigrateConfig    = errors.New("migrate config error")
+	ErrUnknownKey       = errors.New("unknown config key")
 )
\ No newline at end of file
@@ -0,0 +1,125 @@
+package zconf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/zzjcool/goutils/internal/reflectx"
+)
+
+// 选择配置文件和环境的命令行参数
+const (
+	ConfigFlag = "config"
+	EnvFlag    = "env"
+)
+
+// flagLayer 根据配置结构体生成的命令行参数
+type flagLayer struct {
+	set    *pflag.FlagSet
+	fields map[string]*fieldFlag // key为配置项
+}
+
+// fieldFlag 配置项对应的命令行参数，值在合并时按字段的类型解析
+type fieldFlag struct {
+	typ   reflect.Type
+	value string // 没有设置时为default标签，用于显示默认值
+	set   bool
+}
+
+func (f *fieldFlag) String() string {
+	return f.value
+}
+
+// Set 切片类型的参数可以重复设置，例如--hosts a --hosts b
+func (f *fieldFlag) Set(value string) error {
+	if f.set && f.typ.Kind() == reflect.Slice && !strings.HasPrefix(value, "[") {
+		value = f.value + "," + value
+	}
+	f.value, f.set = value, true
+	return nil
+}
+
+func (f *fieldFlag) Type() string {
+	switch {
+	case f.typ == reflectx.DurationType:
+		return "duration"
+	case f.typ.Kind() == reflect.Slice:
+		return "list"
+	case f.typ.Kind() == reflect.Map:
+		return "map"
+	case f.typ.Kind() == reflect.Struct:
+		return "string"
+	default:
+		return f.typ.Kind().String()
+	}
+}
+
+// parseFlags 根据配置结构体生成命令行参数并解析args，参数名为配置项的点分路径，例如--server.port，
+// usage标签作为帮助信息，default标签作为显示的默认值
+func parseFlags(t reflect.Type, o *options) (*flagLayer, error) {
+	name := filepath.Base(os.Args[0])
+	f := &flagLayer{set: pflag.NewFlagSet(name, pflag.ContinueOnError), fields: map[string]*fieldFlag{}}
+	f.set.String(ConfigFlag, "", "config file path")
+	f.set.String(EnvFlag, "", "environment, loads <env>.<config file> after the config file")
+
+	walkFields(t, func(key string, field reflect.StructField, ft reflect.Type) {
+		if key == ConfigFlag || key == EnvFlag {
+			o.log.Infof("flag --%s is reserved, skip field %s", key, field.Name)
+			return
+		}
+		switch ft.Kind() {
+		case reflect.Func, reflect.Chan, reflect.Interface, reflect.UnsafePointer:
+			// 不能通过命令行设置
+			return
+		}
+		ff := &fieldFlag{typ: ft}
+		if tag := field.Tag.Get("default"); tag != "-" {
+			ff.value = tag
+		}
+		flag := f.set.VarPF(ff, key, "", field.Tag.Get("usage"))
+		if ft.Kind() == reflect.Bool {
+			flag.NoOptDefVal = "true"
+		}
+		f.fields[key] = ff
+	})
+
+	if err := f.set.Parse(o.args); err != nil {
+		return nil, errors.Join(err, ErrParseFlags)
+	}
+	return f, nil
+}
+
+// apply 使用--config和--env选择配置文件和环境，返回修改后的选项
+func (f *flagLayer) apply(o *options) *options {
+	c := *o
+	if path, _ := f.set.GetString(ConfigFlag); path != "" {
+		c.fs = NewSearchFs(filepath.Dir(path))
+		c.dir = ""
+		c.configFile = filepath.Base(path)
+	}
+	if env, _ := f.set.GetString(EnvFlag); env != "" {
+		c.env = env
+	}
+	return &c
+}
+
+// mergeFlags 合并命令行中设置的参数，优先级最高
+func (l *layers) mergeFlags(f *flagLayer) error {
+	for key, ff := range f.fields {
+		if !ff.set {
+			continue
+		}
+		value, err := parseValue(ff.typ, ff.value)
+		if err != nil {
+			return &LoadError{Key: key, Expected: typeName(ff.typ), Actual: "flag --" + key,
+				Kind: ErrParseFlags, Err: err}
+		}
+		l.v.Set(key, value)
+		l.sources[key] = Source{Layer: LayerFlag, Name: "--" + key}
+	}
+	return nil
+}
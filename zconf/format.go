@@ -0,0 +1,163 @@
+package zconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format 配置文件的格式
+type Format string
+
+const (
+	FormatYAML   Format = "yaml"
+	FormatJSON   Format = "json"
+	FormatTOML   Format = "toml"
+	FormatDotenv Format = "dotenv" // KEY=VALUE格式，使用双下划线表示嵌套，例如SERVER__PORT=8080
+)
+
+func (f Format) valid() bool {
+	switch f {
+	case FormatYAML, FormatJSON, FormatTOML, FormatDotenv:
+		return true
+	default:
+		return false
+	}
+}
+
+// formatOf 根据文件的扩展名判断格式，.env和xxx.env为dotenv格式
+func formatOf(name string) (Format, error) {
+	switch ext := strings.ToLower(path.Ext(name)); ext {
+	case ".yml", ".yaml":
+		return FormatYAML, nil
+	case ".json":
+		return FormatJSON, nil
+	case ".toml":
+		return FormatTOML, nil
+	case ".env":
+		return FormatDotenv, nil
+	default:
+		return "", fmt.Errorf("unsupported config format %q of file %s", ext, name)
+	}
+}
+
+// nestDotenv 将dotenv中的SERVER__PORT转换为嵌套的server.port
+func nestDotenv(flat map[string]any) map[string]any {
+	nested := map[string]any{}
+	for key, value := range flat {
+		parts := strings.Split(strings.ToLower(key), "__")
+		m := nested
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := m[part].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				m[part] = child
+			}
+			m = child
+		}
+		m[parts[len(parts)-1]] = value
+	}
+	return nested
+}
+
+// keyLines 获取配置文件中每个配置项所在的行，key为小写的点分路径，不支持TOML
+func keyLines(format Format, b []byte) map[string]int {
+	switch format {
+	case FormatYAML:
+		var doc yaml.Node
+		if err := yaml.Unmarshal(b, &doc); err != nil || len(doc.Content) == 0 {
+			return nil
+		}
+		lines := map[string]int{}
+		yamlLines(doc.Content[0], "", lines)
+		return lines
+	case FormatJSON:
+		return jsonLines(b)
+	case FormatDotenv:
+		lines := map[string]int{}
+		for i, line := range strings.Split(string(b), "\n") {
+			key, _, ok := strings.Cut(strings.TrimPrefix(strings.TrimSpace(line), "export "), "=")
+			if ok && !strings.HasPrefix(key, "#") {
+				key = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "__", ".")
+				lines[key] = i + 1
+			}
+		}
+		return lines
+	default:
+		return nil
+	}
+}
+
+func yamlLines(node *yaml.Node, prefix string, lines map[string]int) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := prefix + strings.ToLower(node.Content[i].Value)
+		lines[key] = node.Content[i].Line
+		yamlLines(node.Content[i+1], key+".", lines)
+	}
+}
+
+// jsonLines 获取JSON对象中每个key所在的行，数组中的对象不会被记录
+func jsonLines(b []byte) map[string]int {
+	type frame struct {
+		object    bool
+		expectKey bool
+		key       string
+	}
+	var stack []*frame
+	lines := map[string]int{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+
+	// afterValue 读取一个值之后，对象中的下一个token是key
+	afterValue := func() {
+		if len(stack) > 0 && stack[len(stack)-1].object {
+			stack[len(stack)-1].expectKey = true
+		}
+	}
+	path := func() (string, bool) {
+		var keys []string
+		for _, f := range stack {
+			if !f.object {
+				return "", false
+			}
+			keys = append(keys, f.key)
+		}
+		return strings.ToLower(strings.Join(keys, ".")), true
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return lines
+		}
+		switch t := tok.(type) {
+		case json.Delim:
+			switch t {
+			case '{':
+				stack = append(stack, &frame{object: true, expectKey: true})
+			case '[':
+				stack = append(stack, &frame{})
+			default:
+				stack = stack[:len(stack)-1]
+				afterValue()
+			}
+		case string:
+			if top := len(stack) - 1; top >= 0 && stack[top].expectKey {
+				stack[top].key, stack[top].expectKey = t, false
+				if key, ok := path(); ok {
+					lines[key] = bytes.Count(b[:dec.InputOffset()], []byte("\n")) + 1
+				}
+				continue
+			}
+			afterValue()
+		default:
+			afterValue()
+		}
+	}
+}
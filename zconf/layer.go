@@ -0,0 +1,196 @@
+package zconf
+
+import (
+	"bytes"
+	"io/fs"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Layer 配置的来源，后面的层覆盖前面的层
+type Layer int
+
+const (
+	LayerDefault   Layer = iota + 1 // default标签，没有被其他层设置的字段
+	LayerEmbed                      // WithEmbed添加的内置默认配置
+	LayerFile                       // 配置文件，例如config.yml
+	LayerEnvFile                    // 环境对应的配置文件，例如dev.config.yml
+	LayerExtraFile                  // WithFiles添加的配置文件
+	LayerEnv                        // 环境变量
+	LayerOverride                   // WithOverride设置的值
+	LayerFlag                       // 命令行参数
+)
+
+func (l Layer) String() string {
+	switch l {
+	case LayerDefault:
+		return "default"
+	case LayerEmbed:
+		return "embed"
+	case LayerFile:
+		return "file"
+	case LayerEnvFile:
+		return "env file"
+	case LayerExtraFile:
+		return "extra file"
+	case LayerEnv:
+		return "env"
+	case LayerOverride:
+		return "override"
+	case LayerFlag:
+		return "flag"
+	default:
+		return "unknown"
+	}
+}
+
+// isFile 判断是否为配置文件
+func (l Layer) isFile() bool {
+	return l >= LayerEmbed && l <= LayerExtraFile
+}
+
+// Source 配置项的来源
+type Source struct {
+	Layer Layer
+	Name  string // 文件名、环境变量名、命令行参数或default标签，LayerOverride时为空
+	Line  int    // 配置项在文件中的行号，不支持的格式为0
+}
+
+// String 例如file config.yml:3、env CONF_SERVER_PORT
+func (s Source) String() string {
+	switch {
+	case s.Layer == LayerDefault:
+		return s.Layer.String() + " " + strconv.Quote(s.Name)
+	case s.Name == "":
+		return s.Layer.String()
+	case s.Line > 0:
+		return s.Layer.String() + " " + s.Name + ":" + strconv.Itoa(s.Line)
+	default:
+		return s.Layer.String() + " " + s.Name
+	}
+}
+
+// Sources 每个配置项的来源，key为小写的点分路径，例如server.port
+type Sources map[string]Source
+
+// Lookup 获取配置项的来源，key不区分大小写
+func (s Sources) Lookup(key string) (Source, bool) {
+	src, ok := s[strings.ToLower(key)]
+	return src, ok
+}
+
+// layers 合并各层的配置，并记录每个配置项的来源
+type layers struct {
+	v       *viper.Viper
+	opts    *options
+	sources Sources
+	version int // 配置文件迁移前的版本，没有加载配置文件时为0
+}
+
+func newLayers(o *options) *layers {
+	return &layers{v: viper.New(), opts: o, sources: Sources{}}
+}
+
+// mergeFile 读取配置目录中的配置文件并合并到之前的配置中
+func (l *layers) mergeFile(name string, layer Layer) error {
+	return l.mergeFrom(l.opts.fs, path.Join(l.opts.dir, name), layer)
+}
+
+// mergeFrom 读取fsys中的配置文件并合并到之前的配置中，map会逐个key合并
+func (l *layers) mergeFrom(fsys fs.FS, name string, layer Layer) error {
+	l.opts.log.Debugf("CONFIG File:%v\n", name)
+	format := l.opts.format
+	if format == "" {
+		var err error
+		if format, err = formatOf(name); err != nil {
+			return &LoadError{File: name, Kind: ErrInvalidConfigFile, Err: err}
+		}
+	}
+
+	rawConf, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		l.opts.log.Debug(err)
+		l.opts.log.Debug("The config file is not loaded:", name)
+		return &LoadError{File: name, Kind: ErrOpenConfigFile, Err: err}
+	}
+
+	v := viper.New()
+	v.SetConfigType(string(format))
+	if err := v.ReadConfig(bytes.NewReader(rawConf)); err != nil {
+		l.opts.log.Debugf("read config error:%v", err)
+		return parseError(name, rawConf, err)
+	}
+	settings := v.AllSettings()
+	if format == FormatDotenv {
+		settings = nestDotenv(settings)
+	}
+	m := NewMap(settings)
+	if ms := l.opts.migrations; ms != nil {
+		// 没有version时，配置文件为版本1，环境对应的配置文件和额外的配置文件和配置文件的版本相同，
+		// 没有配置文件时和内置的默认配置一样视为最新的版本
+		version := l.version
+		switch {
+		case layer == LayerFile:
+			version = 1
+		case layer == LayerEmbed || version == 0:
+			version = ms.Latest()
+		}
+		from, err := ms.migrate(m, version)
+		if err != nil {
+			return &LoadError{File: name, Key: VersionKey, Kind: ErrMigrateConfig, Err: err}
+		}
+		if layer == LayerFile {
+			l.version = from
+		}
+		if from < ms.Latest() {
+			l.opts.log.Infof("config %s is migrated from version %d to %d", name, from, ms.Latest())
+		}
+	}
+	if err := l.v.MergeConfigMap(settings); err != nil {
+		return &LoadError{File: name, Kind: ErrInvalidConfigFile, Err: err}
+	}
+	lines := keyLines(format, rawConf)
+	for _, key := range flatKeys(settings, "") {
+		// 迁移过的配置项使用原来位置的行号
+		l.sources[key] = Source{Layer: layer, Name: name, Line: lines[m.origin(key)]}
+	}
+	return nil
+}
+
+// mergeDefaults 记录只由default标签设置的字段
+func (l *layers) mergeDefaults(t reflect.Type) {
+	walkFields(t, func(key string, field reflect.StructField, _ reflect.Type) {
+		tag := field.Tag.Get("default")
+		if tag == "" || tag == "-" {
+			return
+		}
+		if _, ok := l.sources[key]; !ok {
+			l.sources[key] = Source{Layer: LayerDefault, Name: tag}
+		}
+	})
+}
+
+// flatKeys 获取嵌套的map中所有的点分路径
+func flatKeys(m map[string]any, prefix string) []string {
+	var keys []string
+	for key, value := range m {
+		key = strings.ToLower(prefix + key)
+		if child, ok := value.(map[string]any); ok && len(child) > 0 {
+			keys = append(keys, flatKeys(child, key+".")...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (l *layers) mergeOverrides(overrides map[string]any) {
+	for key, value := range overrides {
+		l.v.Set(key, value)
+		l.sources[strings.ToLower(key)] = Source{Layer: LayerOverride}
+	}
+}
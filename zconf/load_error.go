@@ -0,0 +1,169 @@
+package zconf
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// LoadError 加载配置的错误，包含出错的位置。
+// errors.Is可以判断错误的类型，例如ErrInvalidConfigFile或ErrUnmarshalConfig
+type LoadError struct {
+	File   string // 配置文件名
+	Line   int    // 行号，未知时为0
+	Column int    // 列号，未知时为0
+
+	Key      string // 配置项，例如server.port
+	Field    string // 结构体字段的路径，例如Server.Port
+	Expected string // 期望的类型，例如int
+	Actual   string // 实际的类型，例如string
+
+	Kind error // error.go中的错误，例如ErrUnmarshalConfig
+	Err  error // 原始的错误
+}
+
+// Error 例如config.yml:3: Server.Port: expected int, got string: value: 'abc'
+func (e *LoadError) Error() string {
+	var parts []string
+	if e.File != "" {
+		file := e.File
+		if e.Line > 0 {
+			file += ":" + strconv.Itoa(e.Line)
+			if e.Column > 0 {
+				file += ":" + strconv.Itoa(e.Column)
+			}
+		}
+		parts = append(parts, file)
+	}
+	switch {
+	case e.Field != "":
+		parts = append(parts, e.Field)
+	case e.Key != "":
+		parts = append(parts, e.Key)
+	}
+	if e.Expected != "" {
+		expected := "expected " + e.Expected
+		if e.Actual != "" {
+			expected += ", got " + e.Actual
+		}
+		parts = append(parts, expected)
+	}
+	switch {
+	case e.Err != nil:
+		parts = append(parts, e.Err.Error())
+	case e.Kind != nil:
+		parts = append(parts, e.Kind.Error())
+	}
+	return strings.Join(parts, ": ")
+}
+
+// Unwrap 使errors.Is和errors.As可以取到Kind和Err
+func (e *LoadError) Unwrap() []error {
+	var errs []error
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+var yamlLineRe = regexp.MustCompile(`line (\d+)`)
+
+// parseError 将解析配置文件的错误转换为LoadError，尽量获取出错的行和列
+func parseError(file string, raw []byte, err error) *LoadError {
+	le := &LoadError{File: file, Kind: ErrInvalidConfigFile, Err: err}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var tomlErr *toml.DecodeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		le.Line, le.Column = position(raw, syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		le.Line, le.Column = position(raw, typeErr.Offset)
+	case errors.As(err, &tomlErr):
+		le.Line, le.Column = tomlErr.Position()
+	default:
+		if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+			le.Line, _ = strconv.Atoi(m[1])
+		}
+	}
+	return le
+}
+
+// position 将JSON错误的偏移量转换为行和列，偏移量为读取出错的字符之后的位置
+func position(raw []byte, offset int64) (line, column int) {
+	offset--
+	if offset > int64(len(raw)) {
+		offset = int64(len(raw))
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	before := string(raw[:offset])
+	line = strings.Count(before, "\n") + 1
+	column = len(before) - strings.LastIndex(before, "\n")
+	return line, column
+}
+
+var (
+	// 'Server.Port' expected type 'int', got unconvertible type 'string', value: 'abc'
+	unconvertibleRe = regexp.MustCompile(`^'([^']*)' expected type '([^']*)', got unconvertible type '([^']*)'`)
+	// cannot parse 'Server.Port' as int: strconv.ParseInt: parsing "abc": invalid syntax
+	cannotParseRe = regexp.MustCompile(`^cannot parse '([^']*)' as (\w+)`)
+	// 'Server' expected a map, got 'string'
+	expectedRe = regexp.MustCompile(`^'([^']*)' expected an? (\w+), got '([^']*)'`)
+	fieldRe    = regexp.MustCompile(`^'([^']*)'`)
+)
+
+// unmarshalErrors 将mapstructure的错误转换为LoadError，每个字段一个错误，文件和行号从sources中获取
+func unmarshalErrors(err error, sources Sources) error {
+	var mErr *mapstructure.Error
+	if !errors.As(err, &mErr) {
+		return &LoadError{Kind: ErrUnmarshalConfig, Err: err}
+	}
+
+	errs := make([]error, 0, len(mErr.Errors))
+	for _, msg := range mErr.Errors {
+		le := &LoadError{Kind: ErrUnmarshalConfig}
+		detail := msg
+		if m := unconvertibleRe.FindStringSubmatch(msg); m != nil {
+			le.Field, le.Expected, le.Actual = m[1], m[2], m[3]
+			detail = msg[len(m[0]):]
+		} else if m := cannotParseRe.FindStringSubmatch(msg); m != nil {
+			le.Field, le.Expected = m[1], m[2]
+			detail = msg[len(m[0]):]
+		} else if m := expectedRe.FindStringSubmatch(msg); m != nil {
+			le.Field, le.Expected, le.Actual = m[1], m[2], m[3]
+			detail = msg[len(m[0]):]
+		} else if m := fieldRe.FindStringSubmatch(msg); m != nil {
+			le.Field = m[1]
+		}
+		// 去掉已经解析出来的部分，只保留其余的信息，例如value: 'abc'
+		if detail = strings.TrimLeft(detail, ",: "); detail != "" {
+			le.Err = errors.New(detail)
+		}
+
+		// mapstructure中的路径由字段名组成，例如Servers[0].Port，配置项为小写的servers.port
+		le.Key = strings.ToLower(stripIndexes(le.Field))
+		if src, ok := sources.Lookup(le.Key); ok && src.Layer != LayerDefault {
+			if src.Layer.isFile() {
+				le.File, le.Line = src.Name, src.Line
+			} else {
+				if le.Actual == "" {
+					le.Actual = "value"
+				}
+				le.Actual += " from " + src.String()
+			}
+		}
+		errs = append(errs, le)
+	}
+	return errors.Join(errs...)
+}
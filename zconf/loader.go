@@ -0,0 +1,70 @@
+package zconf
+
+import (
+	"errors"
+
+	"github.com/zzjcool/goutils/vtor"
+)
+
+// Logger 加载配置时使用的日志
+type Logger interface {
+	Debug(args ...interface{})
+	Info(args ...interface{})
+	Debugf(template string, args ...interface{})
+	Infof(template string, args ...interface{})
+}
+
+// Validator 加载完成后对配置的校验，在vtor之后执行
+type Validator func(conf any) error
+
+// Loader 使用相同的选项加载配置，Loader之间没有共享的状态，可以在不同的组件或测试中并发使用
+type Loader struct {
+	opts *options
+}
+
+// NewLoader 创建Loader，选项和Load相同
+func NewLoader(opts ...Option) (*Loader, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Loader{opts: o}, nil
+}
+
+// Load 加载配置到conf，conf为结构体指针。依次设置默认值、合并各层配置、解析密钥引用，最后校验配置
+func (l *Loader) Load(conf any) error {
+	o := l.opts.withDefaults()
+	if err := defaultConfig(conf, o); err != nil {
+		o.log.Debug(err)
+		return err
+	}
+	if err := load(conf, o); err != nil {
+		return err
+	}
+	if err := resolveSecrets(conf, o.resolvers); err != nil {
+		return err
+	}
+	return validate(conf, o)
+}
+
+// validate 使用vtor和WithValidators添加的函数校验配置
+func validate(conf any, o *options) error {
+	var errs []error
+	if o.validate {
+		if err := vtor.Validate(conf); err != nil {
+			redactErrors(conf, err)
+			errs = append(errs, err)
+		}
+	}
+	for _, fn := range o.validators {
+		if err := fn(conf); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	err := errors.Join(errs...)
+	o.log.Debug(err)
+	return errors.Join(err, ErrValidateConfig)
+}
@@ -0,0 +1,434 @@
+package zconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/zzjcool/goutils/internal/reflectx"
+	"gopkg.in/yaml.v3"
+)
+
+// VersionKey 配置文件中记录配置版本的key。没有设置时配置文件为版本1，环境对应的配置文件和WithFiles添加的配置文件
+// 和配置文件的版本相同，WithEmbed添加的内置默认配置为最新的版本
+const VersionKey = "version"
+
+// MigrateFunc 将配置迁移到下一个版本
+type MigrateFunc func(m *Map) error
+
+// Migrations 配置的迁移步骤，加载时配置文件会先迁移到最新的版本再解析：
+//
+//	migrations := zconf.NewMigrations().
+//		Register(1, func(m *zconf.Map) error {
+//			m.Move("listen", "server.addr")
+//			return nil
+//		}).
+//		Register(2, func(m *zconf.Map) error {
+//			m.Delete("server.debug")
+//			return nil
+//		})
+//
+//	zconf.Load(conf, zconf.WithMigrations(migrations))
+type Migrations struct {
+	steps  map[int]MigrateFunc
+	latest int
+}
+
+// NewMigrations 创建迁移步骤，没有注册步骤时最新的版本为1
+func NewMigrations() *Migrations {
+	return &Migrations{steps: map[int]MigrateFunc{}, latest: 1}
+}
+
+// Register 注册从版本from迁移到from+1的步骤，from从1开始，重复注册会panic
+func (ms *Migrations) Register(from int, fn MigrateFunc) *Migrations {
+	if from < 1 || fn == nil {
+		panic("zconf: invalid migration from version " + strconv.Itoa(from))
+	}
+	if _, ok := ms.steps[from]; ok {
+		panic("zconf: migration from version " + strconv.Itoa(from) + " is already registered")
+	}
+	ms.steps[from] = fn
+	if from+1 > ms.latest {
+		ms.latest = from + 1
+	}
+	return ms
+}
+
+// Latest 最新的版本
+func (ms *Migrations) Latest() int {
+	return ms.latest
+}
+
+// Migrate 根据m中的version将配置迁移到最新的版本，返回迁移前的版本
+func (ms *Migrations) Migrate(m *Map) (int, error) {
+	return ms.migrate(m, 1)
+}
+
+// migrate 和Migrate相同，m中没有version时使用version
+func (ms *Migrations) migrate(m *Map, version int) (int, error) {
+	if v, ok := m.Get(VersionKey); ok {
+		n, err := strconv.Atoi(fmt.Sprint(v))
+		if err != nil {
+			return 0, fmt.Errorf("invalid config version %v", v)
+		}
+		version = n
+	}
+	if version > ms.latest {
+		return version, fmt.Errorf("config version %d is newer than the latest version %d", version, ms.latest)
+	}
+
+	for v := version; v < ms.latest; v++ {
+		fn, ok := ms.steps[v]
+		if !ok {
+			return version, fmt.Errorf("no migration from version %d", v)
+		}
+		if err := fn(m); err != nil {
+			return version, fmt.Errorf("migrate from version %d: %w", v, err)
+		}
+	}
+	if version < ms.latest {
+		m.Set(VersionKey, ms.latest)
+	}
+	return version, nil
+}
+
+// Map 迁移时的配置，key为点分路径，不区分大小写，例如server.port
+type Map struct {
+	values map[string]any
+	moves  map[string]string // 移动后的路径 -> 原来的路径
+	names  map[string]string // 小写的路径 -> 原来的写法，例如showline -> showLine
+}
+
+// NewMap 使用嵌套的map创建Map，values会被修改
+func NewMap(values map[string]any) *Map {
+	if values == nil {
+		values = map[string]any{}
+	}
+	return &Map{values: values, moves: map[string]string{}, names: map[string]string{}}
+}
+
+// Values 返回嵌套的map，可以直接修改
+func (m *Map) Values() map[string]any {
+	return m.values
+}
+
+// Get 获取配置项的值
+func (m *Map) Get(key string) (any, bool) {
+	parent, name := m.parent(key, false)
+	if parent == nil {
+		return nil, false
+	}
+	v, ok := parent[name]
+	return v, ok
+}
+
+// Set 设置配置项的值，上级的map不存在时会被创建。新的配置项写回文件时使用key的写法
+func (m *Map) Set(key string, value any) {
+	parent, name := m.parent(key, true)
+	parent[name] = value
+	m.addNames(key)
+}
+
+// Delete 删除配置项
+func (m *Map) Delete(key string) {
+	if parent, name := m.parent(key, false); parent != nil {
+		delete(parent, name)
+	}
+	key = strings.ToLower(key)
+	for path := range m.names {
+		if path == key || strings.HasPrefix(path, key+".") {
+			delete(m.names, path)
+		}
+	}
+}
+
+// Move 将配置项移动到新的位置，用于重命名，from不存在时返回false
+func (m *Map) Move(from, to string) bool {
+	v, ok := m.Get(from)
+	if !ok {
+		return false
+	}
+	from, lowerTo := strings.ToLower(from), strings.ToLower(to)
+	// 下级配置项保持原来的写法
+	names := map[string]string{}
+	for path, name := range m.names {
+		if strings.HasPrefix(path, from+".") {
+			names[lowerTo+path[len(from):]] = name
+		}
+	}
+	m.Delete(from)
+	m.Set(to, v)
+	for path, name := range names {
+		if _, ok := m.names[path]; !ok {
+			m.names[path] = name
+		}
+	}
+	m.moves[lowerTo] = m.origin(from)
+	return true
+}
+
+// addNames 记录key中每一级的写法，已经存在的配置项保持原来的写法
+func (m *Map) addNames(key string) {
+	parts := strings.Split(key, ".")
+	for i := range parts {
+		path := strings.ToLower(strings.Join(parts[:i+1], "."))
+		if _, ok := m.names[path]; !ok {
+			m.names[path] = parts[i]
+		}
+	}
+}
+
+// name 获取配置项写回文件时的名称
+func (m *Map) name(key string) string {
+	if name, ok := m.names[key]; ok {
+		return name
+	}
+	return key[strings.LastIndex(key, ".")+1:]
+}
+
+// restore 将values中的key恢复为原来的写法
+func (m *Map) restore(values map[string]any, prefix string) map[string]any {
+	restored := make(map[string]any, len(values))
+	for k, v := range values {
+		key := reflectx.JoinPath(prefix, k)
+		if child, ok := v.(map[string]any); ok {
+			v = m.restore(child, key)
+		}
+		restored[m.name(key)] = v
+	}
+	return restored
+}
+
+// origin 获取配置项迁移前的路径
+func (m *Map) origin(key string) string {
+	for prefix := key; ; {
+		if orig, ok := m.moves[prefix]; ok {
+			return orig + key[len(prefix):]
+		}
+		i := strings.LastIndex(prefix, ".")
+		if i < 0 {
+			return key
+		}
+		prefix = prefix[:i]
+	}
+}
+
+// parent 获取key所在的map，create为true时创建不存在的map
+func (m *Map) parent(key string, create bool) (map[string]any, string) {
+	parts := strings.Split(strings.ToLower(key), ".")
+	current := m.values
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := current[part].(map[string]any)
+		if !ok {
+			if !create {
+				return nil, ""
+			}
+			child = map[string]any{}
+			current[part] = child
+		}
+		current = child
+	}
+	return current, parts[len(parts)-1]
+}
+
+// MigrateFile 将配置文件迁移到最新的版本并写回文件，返回文件是否被修改。
+// 配置项保持原来的写法，YAML文件会尽量保留注释和格式，JSON和TOML文件会被重新格式化
+func MigrateFile(path string, migrations *Migrations) (bool, error) {
+	format, err := formatOf(path)
+	if err != nil {
+		return false, err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	var values map[string]any
+	var doc yaml.Node
+	switch format {
+	case FormatYAML:
+		if err := yaml.Unmarshal(raw, &doc); err != nil {
+			return false, parseError(path, raw, err)
+		}
+		err = doc.Decode(&values)
+	case FormatJSON:
+		err = json.Unmarshal(raw, &values)
+	case FormatTOML:
+		err = toml.Unmarshal(raw, &values)
+	default:
+		return false, fmt.Errorf("migrating %s files is not supported", format)
+	}
+	if err != nil {
+		return false, parseError(path, raw, err)
+	}
+
+	m := NewMap(nil)
+	m.values = m.lowerKeys(values, "")
+	version, err := migrations.Migrate(m)
+	if err != nil {
+		return false, &LoadError{File: path, Key: VersionKey, Kind: ErrMigrateConfig, Err: err}
+	}
+	if version == migrations.Latest() {
+		return false, nil
+	}
+
+	var out []byte
+	switch format {
+	case FormatYAML:
+		var root *yaml.Node
+		if len(doc.Content) > 0 {
+			root = doc.Content[0]
+		}
+		node := migrateNode(m, root, m.values, "")
+		doc = yaml.Node{Kind: yaml.DocumentNode, HeadComment: doc.HeadComment, FootComment: doc.FootComment,
+			Content: []*yaml.Node{node}}
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err = enc.Encode(&doc); err == nil {
+			err = enc.Close()
+		}
+		out = buf.Bytes()
+	case FormatJSON:
+		out, err = json.MarshalIndent(m.restore(m.values, ""), "", "  ")
+		out = append(out, '\n')
+	case FormatTOML:
+		out, err = toml.Marshal(m.restore(m.values, ""))
+	}
+	if err != nil {
+		return false, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(path, out, info.Mode().Perm())
+}
+
+// migrateNode 根据迁移后的值生成yaml.Node，未修改的值和注释从迁移前的节点中复制，
+// 移动过的配置项使用原来位置的注释
+func migrateNode(m *Map, root *yaml.Node, value any, key string) *yaml.Node {
+	old := findNode(root, m.origin(key))
+	if key == "" {
+		old = root
+	}
+
+	values, ok := value.(map[string]any)
+	if !ok {
+		if old != nil && old.Kind != yaml.MappingNode {
+			var oldValue any
+			if old.Decode(&oldValue) == nil && reflect.DeepEqual(oldValue, value) {
+				return old
+			}
+		}
+		node := &yaml.Node{}
+		if err := node.Encode(value); err != nil {
+			node = scalar("!!str", fmt.Sprint(value))
+		}
+		copyComments(node, old)
+		return node
+	}
+
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if old != nil && old.Kind == yaml.MappingNode {
+		node.Style = old.Style
+	}
+	copyComments(node, old)
+
+	// 按照迁移前在文件中的位置排序，新增的配置项在最后
+	names := make([]string, 0, len(values))
+	lines := map[string]int{}
+	for name := range values {
+		names = append(names, name)
+		if n := findNode(root, m.origin(reflectx.JoinPath(key, name))); n != nil {
+			lines[name] = n.Line
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		li, lj := lines[names[i]], lines[names[j]]
+		if (li == 0) != (lj == 0) {
+			return lj == 0
+		}
+		if li != lj {
+			return li < lj
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		childKey := reflectx.JoinPath(key, name)
+		keyNode := scalar("!!str", m.name(childKey))
+		copyComments(keyNode, findKeyNode(root, m.origin(childKey)))
+		node.Content = append(node.Content, keyNode, migrateNode(m, root, values[name], childKey))
+	}
+	return node
+}
+
+func copyComments(node, old *yaml.Node) {
+	if old == nil {
+		return
+	}
+	node.HeadComment, node.LineComment, node.FootComment = old.HeadComment, old.LineComment, old.FootComment
+}
+
+// findNode 获取配置项在迁移前对应的值节点
+func findNode(root *yaml.Node, key string) *yaml.Node {
+	if i := findPair(root, key); i != nil {
+		return i[1]
+	}
+	return nil
+}
+
+// findKeyNode 获取配置项在迁移前对应的key节点
+func findKeyNode(root *yaml.Node, key string) *yaml.Node {
+	if i := findPair(root, key); i != nil {
+		return i[0]
+	}
+	return nil
+}
+
+func findPair(root *yaml.Node, key string) []*yaml.Node {
+	if root == nil || key == "" {
+		return nil
+	}
+	node := root
+	var pair []*yaml.Node
+	for _, part := range strings.Split(key, ".") {
+		if node == nil || node.Kind != yaml.MappingNode {
+			return nil
+		}
+		pair = nil
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if strings.ToLower(node.Content[i].Value) == part {
+				pair = node.Content[i : i+2]
+				break
+			}
+		}
+		if pair == nil {
+			return nil
+		}
+		node = pair[1]
+	}
+	return pair
+}
+
+// lowerKeys 将所有的key转换为小写，和viper读取的配置一致，并记录原来的写法
+func (m *Map) lowerKeys(values map[string]any, prefix string) map[string]any {
+	lowered := make(map[string]any, len(values))
+	for k, v := range values {
+		key := reflectx.JoinPath(prefix, strings.ToLower(k))
+		m.names[key] = k
+		if child, ok := v.(map[string]any); ok {
+			v = m.lowerKeys(child, key)
+		}
+		lowered[strings.ToLower(k)] = v
+	}
+	return lowered
+}
@@ -0,0 +1,284 @@
+package zconf
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/zzjcool/goutils/zoption"
+	"go.uber.org/zap"
+)
+
+// Option 加载配置的选项
+type Option = zoption.Option[*options]
+
+type options struct {
+	validate   bool // 加载后使用vtor校验配置
+	env        string
+	dir        string
+	configFile string
+	files      []string       // 在环境对应的配置文件之后合并的配置文件
+	overrides  map[string]any // 优先级最高的配置项
+	sources    *Sources       // 加载完成后写入每个配置项的来源
+
+	fs          fs.FS    // 读取配置文件的文件系统，为nil时在searchPaths中查找
+	searchPaths []string // 查找配置文件的目录
+	format      Format   // 配置文件的格式，为空时根据文件名判断
+	embedFS     fs.FS    // 内置的默认配置，例如embed.FS
+	embedFiles  []string
+	envPrefix   string // 环境变量的前缀
+	resolvers   map[string]SecretResolver
+	flags       bool     // 解析命令行参数
+	args        []string // 命令行参数，不包含程序名
+	log         Logger   // 为nil时使用加载时的zap.S()
+	validators  []Validator
+	migrations  *Migrations // 解析前将配置文件迁移到最新的版本
+	unknown     unknownMode // 存在未知配置项时的处理方式
+	expandEnv   bool        // 展开default标签中的环境变量
+}
+
+func newOptions(opts []Option) (*options, error) {
+	o := &options{
+		validate:   true,
+		configFile: "config.yml",
+		envPrefix:  DefaultEnvPrefix,
+		resolvers:  defaultResolvers(),
+	}
+	if err := zoption.Build(o, opts...); err != nil {
+		return nil, err
+	}
+	if o.fs == nil && o.searchPaths == nil {
+		o.searchPaths = DefaultSearchPaths(appName())
+	}
+	return o, nil
+}
+
+// withDefaults 返回一次加载使用的选项，没有设置日志和文件系统时使用默认值
+func (o *options) withDefaults() *options {
+	c := *o
+	c.log = o.logger()
+	if c.fs == nil {
+		c.fs = &SearchFs{Paths: c.searchPaths, Log: c.log}
+	}
+	return &c
+}
+
+// logger 获取WithLogger设置的日志，没有设置时在调用时获取zap.S()，这样可以使用zlog初始化之后的日志
+func (o *options) logger() Logger {
+	if o.log != nil {
+		return o.log
+	}
+	return zap.S()
+}
+
+// WithoutValidate 加载后不使用vtor校验配置，WithValidators添加的校验仍然会执行
+func WithoutValidate() Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		o.validate = false
+		return nil
+	})
+}
+
+// WithEnv 设置环境，会在配置文件之后加载环境对应的配置文件，例如dev.config.yml
+func WithEnv(env string) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		o.env = env
+		return nil
+	})
+}
+
+// WithDir 设置配置文件所在的目录，在文件系统中的路径为dir/name
+func WithDir(dir string) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		o.dir = dir
+		return nil
+	})
+}
+
+// WithConfigFile 设置配置文件名，默认为config.yml
+func WithConfigFile(name string) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		if name == "" {
+			return errors.New("config file name is empty")
+		}
+		o.configFile = name
+		return nil
+	})
+}
+
+// WithFiles 添加额外的配置文件，按顺序合并在环境对应的配置文件之后，文件位于配置文件所在的目录
+func WithFiles(names ...string) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		o.files = append(o.files, names...)
+		return nil
+	})
+}
+
+// WithOverride 设置配置项的值，优先级高于配置文件和环境变量，key为点分路径，例如server.port
+func WithOverride(key string, value any) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		if key == "" {
+			return errors.New("override key is empty")
+		}
+		if o.overrides == nil {
+			o.overrides = map[string]any{}
+		}
+		o.overrides[key] = value
+		return nil
+	})
+}
+
+// WithSources 加载完成后将每个配置项的来源写入sources
+func WithSources(sources *Sources) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		o.sources = sources
+		return nil
+	})
+}
+
+// WithFS 从fsys中读取配置文件，例如os.DirFS或embed.FS，设置后不再使用查找路径
+func WithFS(fsys fs.FS) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		if fsys == nil {
+			return errors.New("config fs is nil")
+		}
+		o.fs = fsys
+		return nil
+	})
+}
+
+// WithSearchPaths 设置查找配置文件的目录，每个配置文件使用第一个包含它的目录，
+// 默认为DefaultSearchPaths(程序名)
+func WithSearchPaths(paths ...string) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		o.searchPaths = paths
+		return nil
+	})
+}
+
+// WithFormat 设置配置文件的格式，默认根据文件的扩展名判断
+func WithFormat(format Format) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		if !format.valid() {
+			return fmt.Errorf("unsupported config format %q", format)
+		}
+		o.format = format
+		return nil
+	})
+}
+
+// WithEmbed 使用fsys中的配置文件作为内置的默认配置，优先级低于其他的配置文件。
+// 设置后配置文件可以不存在，例如：
+//
+//	//go:embed config.yml
+//	var defaultConfig embed.FS
+//
+//	zconf.Load(conf, zconf.WithEmbed(defaultConfig, "config.yml"))
+func WithEmbed(fsys fs.FS, names ...string) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		if fsys == nil || len(names) == 0 {
+			return errors.New("embed config fs or file names is empty")
+		}
+		o.embedFS = fsys
+		o.embedFiles = names
+		return nil
+	})
+}
+
+// WithEnvPrefix 设置环境变量的前缀，默认为CONF，为空时不使用前缀，例如server.port对应SERVER_PORT。
+// 使用env标签指定的环境变量不会添加前缀
+func WithEnvPrefix(prefix string) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		o.envPrefix = strings.TrimSuffix(prefix, "_")
+		return nil
+	})
+}
+
+// WithSecretResolver 注册scheme对应的SecretResolver，例如vault，带有`secret:"true"`标签的字段中vault://开头的值会使用r解析。
+// r为nil时取消scheme的解析，file和env默认已经注册
+func WithSecretResolver(scheme string, r SecretResolver) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		if scheme == "" {
+			return errors.New("secret scheme is empty")
+		}
+		if r == nil {
+			delete(o.resolvers, scheme)
+			return nil
+		}
+		o.resolvers[scheme] = r
+		return nil
+	})
+}
+
+// WithFlags 根据配置结构体生成命令行参数并解析os.Args，参数的优先级最高。
+// 参数名为配置项的点分路径，例如--server.port，帮助信息为字段的usage标签。
+// 另外可以通过--config设置配置文件的路径，--env设置环境。
+// 使用--help时返回的错误包含pflag.ErrHelp
+func WithFlags() Option {
+	return WithArgs(os.Args[1:])
+}
+
+// WithArgs 和WithFlags相同，但是解析args而不是os.Args
+func WithArgs(args []string) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		o.flags = true
+		o.args = args
+		return nil
+	})
+}
+
+// WithLogger 设置加载配置时使用的日志，默认为加载时的zap.S()
+func WithLogger(l Logger) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		o.log = l
+		return nil
+	})
+}
+
+// WithValidators 添加加载完成后对配置的校验，在vtor之后执行，返回的错误和ErrValidateConfig合并
+func WithValidators(validators ...Validator) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		o.validators = append(o.validators, validators...)
+		return nil
+	})
+}
+
+// WithMigrations 加载时将每个配置文件按照version迁移到最新的版本，没有version时的版本见VersionKey。迁移只在内存中进行，
+// 需要更新配置文件时使用MigrateFile
+func WithMigrations(migrations *Migrations) Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		if migrations == nil {
+			return errors.New("config migrations is nil")
+		}
+		o.migrations = migrations
+		return nil
+	})
+}
+
+// WithStrict 配置中存在结构体中没有的配置项时加载失败，例如拼写错误的prot: 8080。
+// 返回的错误中每个未知的配置项一个LoadError，包含所在的文件、行号和最接近的配置项
+func WithStrict() Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		o.unknown = unknownError
+		return nil
+	})
+}
+
+// WithExpandEnv 设置默认值时展开default标签中的环境变量，例如`default:"${HOME}/logs"`或`default:"${PORT:-8080}"`，
+// 语法见defaults.WithExpandEnv。环境变量没有设置且没有默认值时加载失败，错误包含ErrSetDefaultValue
+func WithExpandEnv() Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		o.expandEnv = true
+		return nil
+	})
+}
+
+// WithWarnUnknown 和WithStrict相同，但是只通过日志输出未知的配置项，不会加载失败
+func WithWarnUnknown() Option {
+	return zoption.FuncOption[*options](func(o *options) error {
+		o.unknown = unknownWarn
+		return nil
+	})
+}
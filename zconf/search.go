@@ -0,0 +1,71 @@
+package zconf
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSearchPaths 默认的查找目录：./、./config、$HOME/.app和/etc/app，app为空时只查找当前目录
+func DefaultSearchPaths(app string) []string {
+	paths := []string{".", "config"}
+	if app == "" {
+		return paths
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, "."+app))
+	}
+	return append(paths, filepath.Join("/etc", app))
+}
+
+// appName 程序名，用于默认的查找目录
+func appName() string {
+	exe := filepath.Base(os.Args[0])
+	return strings.TrimSuffix(exe, filepath.Ext(exe))
+}
+
+// SearchFs 按顺序在多个目录中查找文件，打开第一个存在的文件
+type SearchFs struct {
+	Paths []string // 相对路径从当前目录开始
+	Log   Logger   // 记录打开的文件，可以为nil
+}
+
+// NewSearchFs 在paths中查找配置文件
+func NewSearchFs(paths ...string) fs.FS {
+	return &SearchFs{Paths: paths}
+}
+
+// Open 打开第一个存在的文件，都不存在时返回fs.ErrNotExist
+func (s *SearchFs) Open(name string) (fs.File, error) {
+	for _, dir := range s.Paths {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		f, err := os.Open(file)
+		if err == nil {
+			if s.Log != nil {
+				s.Log.Debugf("open config file: %s", file)
+			}
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// dir 获取Open打开name时使用的目录，例如config/app，文件都不存在时使用第一个目录
+func (s *SearchFs) dir(name string) string {
+	first := ""
+	for i, dir := range s.Paths {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if i == 0 {
+			first = filepath.Dir(file)
+		}
+		if _, err := os.Stat(file); err == nil {
+			return filepath.Dir(file)
+		}
+	}
+	return first
+}
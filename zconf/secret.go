@@ -0,0 +1,430 @@
+package zconf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/zzjcool/goutils/internal/reflectx"
+	"github.com/zzjcool/goutils/vtor"
+)
+
+// Redacted 替换secret字段的值
+const Redacted = "******"
+
+// SecretResolver 解析secret字段中的密钥引用，例如file:///run/secrets/db、env://DB_PASS或vault://secret/db
+type SecretResolver interface {
+	// Resolve 获取引用对应的值，ref为去掉scheme://之后的部分，例如/run/secrets/db
+	Resolve(ref string) (string, error)
+}
+
+// SecretResolverFunc 函数形式的SecretResolver
+type SecretResolverFunc func(ref string) (string, error)
+
+func (f SecretResolverFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+// FileResolver 读取文件的内容，去掉末尾的换行，例如file:///run/secrets/db
+var FileResolver SecretResolver = SecretResolverFunc(func(ref string) (string, error) {
+	b, err := os.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+})
+
+// EnvResolver 读取环境变量，例如env://DB_PASS，环境变量不存在时返回错误
+var EnvResolver SecretResolver = SecretResolverFunc(func(ref string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("env %s is not set", ref)
+	}
+	return value, nil
+})
+
+func defaultResolvers() map[string]SecretResolver {
+	return map[string]SecretResolver{"file": FileResolver, "env": EnvResolver}
+}
+
+// secrets 解析配置中的密钥引用
+type secrets struct {
+	resolvers map[string]SecretResolver
+	visited   map[uintptr]bool
+}
+
+// resolveSecrets 将配置中带有`secret:"true"`标签的字段中以已注册的scheme开头的字符串替换为解析后的值，
+// 包括默认值、配置文件、环境变量和WithOverride设置的值。secret字段为结构体、切片或map时解析其中所有的字符串，
+// 其他字段不会被修改，例如普通字段中的file:///etc/hostname
+func resolveSecrets(conf any, resolvers map[string]SecretResolver) error {
+	if len(resolvers) == 0 {
+		return nil
+	}
+	s := &secrets{resolvers: resolvers, visited: map[uintptr]bool{}}
+	return s.resolve(reflect.ValueOf(conf), "", false)
+}
+
+// resolve 解析v中的密钥引用，secret表示v属于secret字段
+func (s *secrets) resolve(v reflect.Value, path string, secret bool) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || s.visited[v.Pointer()] {
+			return nil
+		}
+		s.visited[v.Pointer()] = true
+		return s.resolve(v.Elem(), path, secret)
+
+	case reflect.String:
+		if !secret {
+			return nil
+		}
+		value, ok, err := s.resolveString(v.String())
+		if err != nil {
+			return &LoadError{Field: path, Kind: ErrResolveSecret, Err: err}
+		}
+		if ok && v.CanSet() {
+			v.SetString(value)
+		}
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if err := s.resolve(v.Field(i), reflectx.JoinPath(path, field.Name), secret || isSecret(field)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := s.resolve(v.Index(i), path+"["+strconv.Itoa(i)+"]", secret); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// map中的值不能直接修改，复制后再写回
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			if err := s.resolve(elem, fmt.Sprintf("%s[%v]", path, iter.Key()), secret); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	}
+	return nil
+}
+
+// resolveString 解析scheme://ref格式的引用，scheme没有注册时返回false
+func (s *secrets) resolveString(value string) (string, bool, error) {
+	scheme, ref, ok := strings.Cut(value, "://")
+	if !ok {
+		return "", false, nil
+	}
+	r, ok := s.resolvers[scheme]
+	if !ok {
+		return "", false, nil
+	}
+	resolved, err := r.Resolve(ref)
+	return resolved, true, err
+}
+
+// Redact 复制配置，并将带有`secret:"true"`标签的字段中的字符串替换为Redacted，结构体、切片和map中的每个字符串都会被替换，
+// 其他类型设置为零值，
+// 用于打印或记录配置。conf不会被修改
+func Redact[T any](conf T) T {
+	v := reflect.ValueOf(&conf).Elem()
+	if !hasSecrets(v.Type(), nil) {
+		return conf
+	}
+	v.Set(redact(v, map[uintptr]reflect.Value{}))
+	return conf
+}
+
+// redact 返回v的副本，只复制包含secret字段的指针、切片和map
+func redact(v reflect.Value, copied map[uintptr]reflect.Value) reflect.Value {
+	if !hasSecrets(v.Type(), nil) {
+		return v
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		if c, ok := copied[v.Pointer()]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		copied[v.Pointer()] = c
+		c.Elem().Set(redact(v.Elem(), copied))
+		return c
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(redact(v.Elem(), copied))
+		return c
+
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if isSecret(field) {
+				// 同一个指针在其他字段中不需要替换，单独记录复制过的指针
+				c.Field(i).Set(redactSecret(v.Field(i), map[uintptr]reflect.Value{}))
+				continue
+			}
+			c.Field(i).Set(redact(v.Field(i), copied))
+		}
+		return c
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(redact(v.Index(i), copied))
+		}
+		return c
+
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(redact(v.Index(i), copied))
+		}
+		return c
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), redact(iter.Value(), copied))
+		}
+		return c
+
+	default:
+		return v
+	}
+}
+
+// redactSecret 返回secret字段的副本，其中所有的字符串都替换为Redacted，结构体、指针、切片和map中的字符串也会被替换，
+// 其他类型设置为零值
+func redactSecret(v reflect.Value, copied map[uintptr]reflect.Value) reflect.Value {
+	if !hasStrings(v.Type(), nil) {
+		return reflect.Zero(v.Type())
+	}
+	switch v.Kind() {
+	case reflect.String:
+		c := reflect.New(v.Type()).Elem()
+		c.SetString(Redacted)
+		return c
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		if c, ok := copied[v.Pointer()]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		copied[v.Pointer()] = c
+		c.Elem().Set(redactSecret(v.Elem(), copied))
+		return c
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(redactSecret(v.Elem(), copied))
+		return c
+
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() {
+				c.Field(i).Set(redactSecret(v.Field(i), copied))
+			}
+		}
+		return c
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		// 切片和原来的配置共用底层数组，需要复制
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(redactSecret(v.Index(i), copied))
+		}
+		return c
+
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(redactSecret(v.Index(i), copied))
+		}
+		return c
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), redactSecret(iter.Value(), copied))
+		}
+		return c
+
+	default:
+		return reflect.Zero(v.Type())
+	}
+}
+
+// hasStrings 判断类型为t的值中是否有字符串
+func hasStrings(t reflect.Type, stack []reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return hasStrings(t.Elem(), stack)
+	case reflect.Struct:
+		if reflectx.OnStack(stack, t) {
+			return false
+		}
+		stack = append(stack, t)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.IsExported() && hasStrings(field.Type, stack) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isSecret(field reflect.StructField) bool {
+	secret, _ := strconv.ParseBool(field.Tag.Get("secret"))
+	return secret
+}
+
+// hasSecrets 判断类型为t的值中是否有secret字段
+func hasSecrets(t reflect.Type, stack []reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return hasSecrets(t.Elem(), stack)
+	case reflect.Struct:
+		if reflectx.OnStack(stack, t) {
+			return false
+		}
+		stack = append(stack, t)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.IsExported() && (isSecret(field) || hasSecrets(field.Type, stack)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// redactErrors 清除校验错误中secret字段的值，避免记录到日志中
+func redactErrors(conf any, err error) {
+	var errs vtor.Errors
+	if !errors.As(err, &errs) {
+		return
+	}
+	paths := secretPaths(reflect.TypeOf(conf))
+	for _, fe := range errs {
+		if inSecret(paths, stripIndexes(fe.Path)) {
+			fe.Value = Redacted
+		}
+	}
+}
+
+// inSecret 判断path是否为secret字段或者secret字段中的字段，例如DB.Password属于secret字段DB
+func inSecret(paths map[string]bool, path string) bool {
+	for {
+		if paths[path] {
+			return true
+		}
+		i := strings.LastIndexByte(path, '.')
+		if i < 0 {
+			return false
+		}
+		path = path[:i]
+	}
+}
+
+// secretPaths 获取所有secret字段的路径，切片和map中的字段不包含下标，例如Servers.Password
+func secretPaths(t reflect.Type) map[string]bool {
+	paths := map[string]bool{}
+	var walk func(t reflect.Type, path string, stack []reflect.Type)
+	walk = func(t reflect.Type, path string, stack []reflect.Type) {
+		for {
+			switch t.Kind() {
+			case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+				t = t.Elem()
+				continue
+			}
+			break
+		}
+		if t.Kind() != reflect.Struct || reflectx.OnStack(stack, t) {
+			return
+		}
+		stack = append(stack, t)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fieldPath := reflectx.JoinPath(path, field.Name)
+			if isSecret(field) {
+				paths[fieldPath] = true
+			}
+			walk(field.Type, fieldPath, stack)
+		}
+	}
+	walk(t, "", nil)
+	return paths
+}
+
+// stripIndexes 去掉路径中的下标，例如Servers[0].Password转换为Servers.Password
+func stripIndexes(path string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range path {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
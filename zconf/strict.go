@@ -0,0 +1,203 @@
+package zconf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zzjcool/goutils/internal/reflectx"
+)
+
+// unknownMode 配置中存在结构体中没有的配置项时的处理方式
+type unknownMode int
+
+const (
+	unknownIgnore unknownMode = iota
+	unknownWarn               // 通过日志输出
+	unknownError              // 加载失败
+)
+
+// checkUnknown 检查合并后的配置中结构体没有的配置项，例如拼写错误的prot: 8080，
+// 列表中的结构体也会检查，例如servers[0].prot
+func (l *layers) checkUnknown(t reflect.Type) error {
+	if l.opts.unknown == unknownIgnore {
+		return nil
+	}
+
+	var errs []error
+	report := func(key, source string, suggestions []string) {
+		le := &LoadError{Key: key, Kind: ErrUnknownKey}
+		if src, ok := l.sources[source]; ok && src.Layer.isFile() {
+			le.File, le.Line = src.Name, src.Line
+		}
+		if len(suggestions) > 0 {
+			le.Err = fmt.Errorf("unknown key, did you mean %s?", strings.Join(suggestions, " or "))
+		}
+		errs = append(errs, le)
+	}
+	var extra []string
+	if l.opts.migrations != nil {
+		extra = append(extra, VersionKey)
+	}
+	keys := l.v.AllKeys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		checkKeys(t, key, l.v.Get(key), "", extra, func(key string, suggestions []string) {
+			report(key, strings.SplitN(key, "[", 2)[0], suggestions)
+		})
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+
+	err := errors.Join(errs...)
+	if l.opts.unknown == unknownWarn {
+		l.opts.log.Info(err)
+		return nil
+	}
+	return err
+}
+
+// checkKeys 检查结构体t中的配置项key，key对应的字段为结构体列表时检查每个元素中的配置项，
+// prefix为t在配置中的路径，例如servers[0].
+func checkKeys(t reflect.Type, key string, value any, prefix string, extra []string,
+	report func(key string, suggestions []string)) {
+	known := extra
+	var elem reflect.Type
+	walkFields(t, func(k string, _ reflect.StructField, ft reflect.Type) {
+		known = append(known, k)
+		if k == key {
+			elem = structElem(ft)
+		}
+	})
+	if !isKnown(known, key) {
+		suggestions := suggest(known, key)
+		for i := range suggestions {
+			suggestions[i] = prefix + suggestions[i]
+		}
+		report(prefix+key, suggestions)
+		return
+	}
+
+	items, ok := value.([]any)
+	if elem == nil || !ok {
+		return
+	}
+	for i, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		elemPrefix := prefix + key + "[" + strconv.Itoa(i) + "]."
+		for _, k := range flatten(m, "") {
+			checkKeys(elem, k, lookup(m, k), elemPrefix, nil, report)
+		}
+	}
+}
+
+// structElem 获取切片或数组中以配置项表示的结构体元素，其他类型返回nil
+func structElem(t reflect.Type) reflect.Type {
+	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		return nil
+	}
+	elem := t.Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct || reflectx.IsText(elem) {
+		return nil
+	}
+	return elem
+}
+
+// flatten 获取嵌套的map中所有的配置项，和viper一样使用小写的点分路径，按字母顺序返回
+func flatten(m map[string]any, prefix string) []string {
+	var keys []string
+	for k, v := range m {
+		key := prefix + strings.ToLower(k)
+		if child, ok := v.(map[string]any); ok && len(child) > 0 {
+			keys = append(keys, flatten(child, key+".")...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lookup 获取嵌套的map中点分路径对应的值，key不区分大小写
+func lookup(m map[string]any, key string) any {
+	var value any = m
+	for _, part := range strings.Split(key, ".") {
+		child, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = nil
+		for k, v := range child {
+			if strings.EqualFold(k, part) {
+				value = v
+				break
+			}
+		}
+	}
+	return value
+}
+
+// isKnown 判断key是否为结构体中的配置项，map等字段下的配置项也是已知的
+func isKnown(known []string, key string) bool {
+	for _, k := range known {
+		if key == k || strings.HasPrefix(key, k+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// suggest 获取和key最接近的配置项，编辑距离超过key长度的三分之一时没有建议
+func suggest(known []string, key string) []string {
+	limit := len(key) / 3
+	if limit < 2 {
+		limit = 2
+	}
+	var suggestions []string
+	for _, k := range known {
+		d := distance(key, k)
+		switch {
+		case d < limit:
+			limit, suggestions = d, []string{k}
+		case d == limit:
+			suggestions = append(suggestions, k)
+		}
+	}
+	return suggestions
+}
+
+// distance 计算两个字符串的编辑距离，相邻字符交换算作一次编辑
+func distance(a, b string) int {
+	rows := make([][]int, len(a)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d := min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d = min(d, rows[i-2][j-2]+1)
+			}
+			rows[i][j] = d
+		}
+	}
+	return rows[len(a)][len(b)]
+}
@@ -0,0 +1,168 @@
+package zconf
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDelay 文件变化后等待的时间，编辑器保存文件时通常会触发多个事件，合并为一次重新加载
+const watchDelay = 100 * time.Millisecond
+
+// Watcher 监听配置文件的变化，文件变化后重新加载配置
+type Watcher[T any] struct {
+	current atomic.Pointer[T]
+
+	loader *Loader
+	dir    string
+	files  map[string]bool // 监听的配置文件名
+
+	mu       sync.Mutex // 保护onChange和onError，并保证同一时间只有一个重新加载
+	onChange []func(old, new *T)
+	onError  []func(error)
+
+	watcher   *fsnotify.Watcher
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Watch 加载配置到conf并监听配置文件，文件变化时会将配置重新加载到一个新的T中，
+// 经过默认值、解析和校验后替换当前的配置，再调用OnChange注册的回调。
+// 重新加载失败时保留之前的配置，并调用OnError注册的回调。
+//
+// 配置文件通过WithDir、WithConfigFile和WithEnv设置，和Load一样在查找路径中查找配置文件(WithDir为绝对路径时直接使用这个目录)，
+// 之后只在配置文件所在的目录中读取和监听配置文件。Watch需要监听本地的目录，不支持WithFS。
+// 使用Get获取当前的配置，不再需要时调用Close停止监听。
+func Watch[T any](conf *T, opts ...Option) (*Watcher[T], error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if o.fs != nil {
+		return nil, errors.New("watch does not support WithFS, use WithDir or WithSearchPaths")
+	}
+	dir := o.dir
+	if !filepath.IsAbs(dir) {
+		search := &SearchFs{Paths: o.searchPaths}
+		dir = search.dir(path.Join(o.dir, o.configFile))
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher[T]{
+		loader: &Loader{opts: o},
+		dir:    dir,
+		files:  map[string]bool{o.configFile: true},
+		done:   make(chan struct{}),
+	}
+	if o.env != "" {
+		w.files[o.env+"."+o.configFile] = true
+	}
+	o.searchPaths, o.dir = []string{dir}, ""
+	if err := w.loader.Load(conf); err != nil {
+		return nil, err
+	}
+	w.current.Store(conf)
+
+	// 监听目录而不是文件，这样通过重命名替换文件(例如vim保存)时也能收到事件
+	w.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.watcher.Add(dir); err != nil {
+		w.watcher.Close()
+		return nil, err
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// Get 获取当前的配置，返回的配置不应该被修改
+func (w *Watcher[T]) Get() *T {
+	return w.current.Load()
+}
+
+// OnChange 注册配置变化后的回调，old为之前的配置，new为新的配置
+func (w *Watcher[T]) OnChange(fn func(old, new *T)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onChange = append(w.onChange, fn)
+}
+
+// OnError 注册重新加载失败的回调
+func (w *Watcher[T]) OnError(fn func(error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onError = append(w.onError, fn)
+}
+
+// Reload 立即重新加载配置，失败时保留之前的配置并返回错误
+func (w *Watcher[T]) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	conf := new(T)
+	if err := w.loader.Load(conf); err != nil {
+		w.loader.opts.logger().Infof("reload config failed: %v", err)
+		for _, fn := range w.onError {
+			fn(err)
+		}
+		return err
+	}
+	old := w.current.Swap(conf)
+	w.loader.opts.logger().Info("config reloaded")
+	for _, fn := range w.onChange {
+		fn(old, conf)
+	}
+	return nil
+}
+
+// Close 停止监听，可以多次并发调用
+func (w *Watcher[T]) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.closeErr = w.watcher.Close()
+		w.wg.Wait()
+	})
+	return w.closeErr
+}
+
+func (w *Watcher[T]) run() {
+	defer w.wg.Done()
+
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if w.files[filepath.Base(event.Name)] && event.Op != fsnotify.Chmod {
+				timer.Reset(watchDelay)
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.loader.opts.logger().Infof("watch config error: %v", err)
+		case <-timer.C:
+			// 失败时已经记录日志并调用了OnError，文件被删除时等待重新创建
+			_ = w.Reload()
+		}
+	}
+}
@@ -1,10 +1,15 @@
 package zhttp
 
 import (
+	"fmt"
+	"sync/atomic"
+
 	"github.com/gin-gonic/gin"
 	"github.com/zzjcool/ginhelper"
 	"github.com/zzjcool/goutils/defaults"
 	"github.com/zzjcool/goutils/ferr"
+	"github.com/zzjcool/goutils/vtor"
+	"go.uber.org/zap"
 )
 
 type BaseParam struct {
@@ -12,6 +17,17 @@ type BaseParam struct {
 	RequestID string `header:"requestID"`
 }
 
+var paramValidation atomic.Bool
+
+func init() {
+	paramValidation.Store(true)
+}
+
+// SetParamValidation 设置Bind是否使用vtor校验参数，默认开启
+func SetParamValidation(enabled bool) {
+	paramValidation.Store(enabled)
+}
+
 func (param *BaseParam) Bind(c *gin.Context, p ginhelper.Parameter) error {
 	err := defaults.Apply(p)
 	if err != nil {
@@ -20,6 +36,23 @@ func (param *BaseParam) Bind(c *gin.Context, p ginhelper.Parameter) error {
 	if err := c.ShouldBind(p); err != nil {
 		return NewE(ferr.Convert(err), ErrParameterMatch)
 	}
+	if paramValidation.Load() {
+		return validateParam(p)
+	}
+	return nil
+}
+
+// validateParam 使用vtor校验参数，标签错误时vtor会panic，恢复后作为服务端错误返回，不影响其他请求
+func validateParam(p ginhelper.Parameter) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("validate parameter", zap.Any("panic", r))
+			err = NewE(ferr.New(fmt.Sprint(r)), ErrServerPanic)
+		}
+	}()
+	if err := vtor.Validate(p); err != nil {
+		return NewE(ferr.Convert(err), ErrParameterMatch)
+	}
 	return nil
 }
 
@@ -0,0 +1,100 @@
+package zhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zzjcool/ginhelper"
+)
+
+type createUserParam struct {
+	BaseParam
+	Name  string `json:"name" vtor:"required"`
+	Email string `json:"email" vtor:"email"`
+	Age   int    `json:"age" vtor:"min=18"`
+}
+
+func (p *createUserParam) Handler(c *gin.Context) (ginhelper.Data, error) {
+	return p.Name, nil
+}
+
+type badTagParam struct {
+	BaseParam
+	Name string `json:"name" vtor:"min=abc"`
+}
+
+func (p *badTagParam) Handler(c *gin.Context) (ginhelper.Data, error) {
+	return p.Name, nil
+}
+
+// serveParam 使用p绑定请求并返回结果，和ginhelper注册的路由处理流程相同
+func serveParam(p ginhelper.Parameter, body string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.POST("/", func(c *gin.Context) {
+		if err := p.Bind(c, p); err != nil {
+			p.Result(c, nil, err)
+			return
+		}
+		data, err := p.Handler(c)
+		p.Result(c, data, err)
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestBindValidation(t *testing.T) {
+	w := serveParam(&createUserParam{}, `{"email": "not an email", "age": 17}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	var result struct {
+		Code int          `json:"code"`
+		Data []FieldError `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Code != ErrParameterMatch.Code() {
+		t.Fatalf("expected code %d, got %d", ErrParameterMatch.Code(), result.Code)
+	}
+	rules := map[string]string{}
+	for _, fe := range result.Data {
+		rules[fe.Field] = fe.Rule
+	}
+	expected := map[string]string{"Name": "required", "Email": "email", "Age": "min"}
+	if len(rules) != len(expected) {
+		t.Fatalf("unexpected field errors %+v", result.Data)
+	}
+	for field, rule := range expected {
+		if rules[field] != rule {
+			t.Errorf("%s: expected rule %s, got %q", field, rule, rules[field])
+		}
+	}
+
+	if w := serveParam(&createUserParam{}, `{"name": "a", "email": "a@example.com", "age": 18}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestBindInvalidTag(t *testing.T) {
+	w := serveParam(&badTagParam{}, `{"name": "a"}`)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+	var result struct {
+		Code int `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Code != ErrServerPanic.Code() {
+		t.Fatalf("expected code %d, got %d", ErrServerPanic.Code(), result.Code)
+	}
+}
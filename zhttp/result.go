@@ -1,12 +1,14 @@
 package zhttp
 
 import (
+	"errors"
 	"net/http"
 
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/zzjcool/goutils/ferr"
+	"github.com/zzjcool/goutils/vtor"
 )
 
 type baseResult struct {
@@ -26,6 +28,33 @@ type errorResult struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
+// FieldError 参数校验未通过的字段，参数校验失败时作为data返回
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// fieldErrors 获取err中参数校验未通过的字段
+func fieldErrors(err error) []FieldError {
+	for err != nil {
+		var errs vtor.Errors
+		if errors.As(err, &errs) {
+			fes := make([]FieldError, len(errs))
+			for i, fe := range errs {
+				fes[i] = FieldError{Field: fe.Path, Rule: fe.Rule, Message: fe.Error()}
+			}
+			return fes
+		}
+		u, ok := err.(interface{ UnWrap() error })
+		if !ok || u.UnWrap() == err {
+			return nil
+		}
+		err = u.UnWrap()
+	}
+	return nil
+}
+
 func Result(c *gin.Context, data interface{}, err error) {
 
 	if c.IsAborted() {
@@ -47,6 +76,11 @@ func Result(c *gin.Context, data interface{}, err error) {
 			fe := ferr.Convert(err)
 			log.Debug(fe.TraceStack())
 		}
+		if data == nil {
+			if fes := fieldErrors(err); fes != nil {
+				data = fes
+			}
+		}
 		result := errorResult{
 			baseResult{
 				Time:      time.Now().Unix(),
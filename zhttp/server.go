@@ -1,15 +1,20 @@
 package zhttp
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"os/signal"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/zzjcool/goutils"
 	"github.com/zzjcool/goutils/defaults"
-	"github.com/zzjcool/goutils/str"
 	"github.com/zzjcool/goutils/zlog"
 	"go.uber.org/zap"
 )
@@ -21,21 +26,67 @@ type HttpServerConfig struct {
 	Name       string `default:"httpserver"`
 	Port       uint   `default:"12321"`
 	Https      bool
-	Cert       string
-	Key        string
+	Cert       string     // Https为true时使用的PEM格式的证书，更多的选项使用TLS
+	Key        string     // Https为true时使用的PEM格式的私钥
+	TLS        *TLSConfig `default:"-"` // 不为nil时启用Https
 	RouterFunc loadRouterFunc
+
+	DrainTimeout  time.Duration                   `default:"30s"` // 关闭时等待请求处理完成的最长时间，超时后强制关闭连接
+	ShutdownDelay time.Duration                   // 关闭时Readiness变为false之后，等待负载均衡摘除流量的时间
+	Readiness     *Readiness                      `default:"-"` // 服务是否就绪，为nil时自动创建，可以在RouterFunc中注册Readiness.Handler()
+	OnStart       func(ctx context.Context) error // 开始监听端口之后执行，返回错误时关闭服务
+	OnShutdown    func(ctx context.Context) error // 请求处理完成之后执行，ctx在DrainTimeout后超时
 }
 
-var once sync.Once
+// Readiness 服务是否就绪，启动完成后为true，开始关闭时变为false
+type Readiness struct {
+	ready atomic.Bool
+}
+
+// Ready 服务是否就绪
+func (r *Readiness) Ready() bool {
+	return r.ready.Load()
+}
 
+// Handler 就绪检查的接口，就绪时返回200，否则返回503，例如：
+//
+//	r.GET("/readyz", c.Readiness.Handler())
+func (r *Readiness) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if r.Ready() {
+			c.String(http.StatusOK, "ok")
+			return
+		}
+		c.String(http.StatusServiceUnavailable, "not ready")
+	}
+}
 
+var once sync.Once
 
 var log zlog.Logger = zap.S()
 
 func SetLogger(l zlog.Logger) {
 	log = l
 }
+
+// Serve 启动Http服务，一直运行到出错为止，不处理信号。需要优雅关闭时使用ServeContext
 func Serve(c *HttpServerConfig) error {
+	return serveContext(context.Background(), c)
+}
+
+// ServeContext 启动Http服务，ctx取消或收到SIGTERM时优雅关闭：
+// Readiness变为false，等待ShutdownDelay，在DrainTimeout内等待请求处理完成，最后执行OnShutdown。
+// 正常关闭时返回nil
+func ServeContext(ctx context.Context, c *HttpServerConfig) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM)
+	defer stop()
+	// 开始关闭后恢复默认的信号处理，再次收到SIGTERM时直接退出
+	context.AfterFunc(ctx, stop)
+	return serveContext(ctx, c)
+}
+
+// serveContext 启动Http服务，ctx取消时优雅关闭
+func serveContext(ctx context.Context, c *HttpServerConfig) error {
 	if err := defaults.Apply(c); err != nil {
 		log.Error("apply default", zap.Error(err))
 		return err
@@ -47,45 +98,90 @@ func Serve(c *HttpServerConfig) error {
 			log.Debug(httpMethod + "\t" + absolutePath)
 		}
 	})
+	if c.Readiness == nil {
+		c.Readiness = &Readiness{}
+	}
 	r := gin.New()
 	c.RouterFunc(r)
-	if c.Https {
-		return serveTLS(c.Port, r, c.Cert, c.Key)
+	s := newServer(c.Port, r)
+	tlsConf := c.TLS
+	if tlsConf == nil && c.Https {
+		tlsConf = &TLSConfig{Cert: c.Cert, Key: c.Key}
+	}
+	if tlsConf != nil {
+		var err error
+		if s.TLSConfig, err = NewTLSConfig(tlsConf); err != nil {
+			return err
+		}
+	}
+
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	served := make(chan error, 1)
+	go func() {
+		if s.TLSConfig != nil {
+			log.Info("tls address: https://" + s.Addr)
+			served <- s.ServeTLS(ln, "", "")
+			return
+		}
+		log.Info("Service running address: http://" + s.Addr)
+		served <- s.Serve(ln)
+	}()
+
+	if c.OnStart != nil {
+		if err := c.OnStart(ctx); err != nil {
+			return errors.Join(err, shutdown(s, c, served))
+		}
 	}
-	return serve(c.Port, r)
+	c.Readiness.ready.Store(true)
+
+	select {
+	case err := <-served:
+		c.Readiness.ready.Store(false)
+		return err
+	case <-ctx.Done():
+	}
+	return shutdown(s, c, served)
 }
 
-func serve(port uint, r http.Handler) error {
-	if !goutils.LegalPort(port) {
-		log.Panic("Port range error", zap.String("error", "Port range error"))
+// shutdown 优雅关闭服务，served为Serve的返回值
+func shutdown(s *http.Server, c *HttpServerConfig, served <-chan error) error {
+	c.Readiness.ready.Store(false)
+	log.Info("Service shutting down: " + c.Name)
+	if c.ShutdownDelay > 0 {
+		time.Sleep(c.ShutdownDelay)
 	}
-	addr := fmt.Sprintf("0.0.0.0:%d", port)
-	log.Info("Service running address: http://" + addr)
-	s := &http.Server{
-		Addr:           addr,
-		Handler:        r,
-		ReadTimeout:    60 * time.Second,
-		WriteTimeout:   60 * time.Second,
-		MaxHeaderBytes: 1 << 20,
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.DrainTimeout)
+	defer cancel()
+	err := s.Shutdown(ctx)
+	if err != nil {
+		log.Error("drain connections", zap.Error(err))
+		err = errors.Join(err, s.Close())
 	}
-	return s.ListenAndServe()
+	if serveErr := <-served; !errors.Is(serveErr, http.ErrServerClosed) {
+		err = errors.Join(err, serveErr)
+	}
+
+	if c.OnShutdown != nil {
+		hookCtx, cancel := context.WithTimeout(context.Background(), c.DrainTimeout)
+		defer cancel()
+		err = errors.Join(err, c.OnShutdown(hookCtx))
+	}
+	return err
 }
 
-func serveTLS(port uint, r http.Handler, cert, key string) error {
+func newServer(port uint, r http.Handler) *http.Server {
 	if !goutils.LegalPort(port) {
 		log.Panic("Port range error", zap.String("error", "Port range error"))
 	}
-	addr := fmt.Sprintf("0.0.0.0:%d", port)
-	log.Info("tls address: https://" + addr)
-	s := &http.Server{
-		Addr:           addr,
+	return &http.Server{
+		Addr:           fmt.Sprintf("0.0.0.0:%d", port),
 		Handler:        r,
 		ReadTimeout:    60 * time.Second,
 		WriteTimeout:   60 * time.Second,
 		MaxHeaderBytes: 1 << 20,
 	}
-	certFile, keyFile := str.TempFile(cert), str.TempFile(key)
-
-	log.Info("certFile: ", certFile, " keyFile: ", keyFile)
-	return s.ListenAndServeTLS(certFile, keyFile)
 }
@@ -0,0 +1,193 @@
+package zhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// freePort 获取一个未被占用的端口
+func freePort(t *testing.T) uint {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return uint(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// start 在后台启动服务，等待OnStart执行后返回服务的地址和ServeContext的返回值
+func start(t *testing.T, ctx context.Context, c *HttpServerConfig) (string, <-chan error) {
+	t.Helper()
+	c.Port = freePort(t)
+	started := make(chan struct{})
+	onStart := c.OnStart
+	c.OnStart = func(ctx context.Context) error {
+		close(started)
+		if onStart != nil {
+			return onStart(ctx)
+		}
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- ServeContext(ctx, c) }()
+	select {
+	case <-started:
+	case err := <-done:
+		t.Fatalf("server stopped before start: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not start")
+	}
+	return "127.0.0.1:" + strconv.Itoa(int(c.Port)), done
+}
+
+func wait(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+		return nil
+	}
+}
+
+func pingRouter(r *gin.Engine) {
+	r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+}
+
+func get(t *testing.T, client *http.Client, url string) (int, string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestServeHTTP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, done := start(t, ctx, &HttpServerConfig{RouterFunc: pingRouter})
+
+	if code, body := get(t, http.DefaultClient, "http://"+addr+"/ping"); code != http.StatusOK || body != "pong" {
+		t.Fatalf("unexpected response %d %q", code, body)
+	}
+	cancel()
+	if err := wait(t, done); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServeContextDrain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entered := make(chan struct{})
+	events := make(chan string, 2)
+	c := &HttpServerConfig{
+		DrainTimeout: 5 * time.Second,
+		RouterFunc: func(r *gin.Engine) {
+			r.GET("/slow", func(c *gin.Context) {
+				close(entered)
+				time.Sleep(200 * time.Millisecond)
+				events <- "handled"
+				c.String(http.StatusOK, "done")
+			})
+		},
+		OnShutdown: func(ctx context.Context) error {
+			events <- "shutdown"
+			return nil
+		},
+	}
+	addr, done := start(t, ctx, c)
+
+	responses := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err == nil {
+			defer resp.Body.Close()
+			if body, _ := io.ReadAll(resp.Body); string(body) != "done" {
+				err = fmt.Errorf("unexpected response %d %q", resp.StatusCode, body)
+			}
+		}
+		responses <- err
+	}()
+	<-entered
+	cancel()
+
+	if err := <-responses; err != nil {
+		t.Fatalf("in-flight request was not drained: %v", err)
+	}
+	if err := wait(t, done); err != nil {
+		t.Fatal(err)
+	}
+	// OnShutdown在请求处理完成之后执行
+	if first, second := <-events, <-events; first != "handled" || second != "shutdown" {
+		t.Fatalf("unexpected order %s, %s", first, second)
+	}
+}
+
+func TestServeContextReadiness(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &HttpServerConfig{ShutdownDelay: 300 * time.Millisecond}
+	c.RouterFunc = func(r *gin.Engine) {
+		r.GET("/readyz", c.Readiness.Handler())
+	}
+	addr, done := start(t, ctx, c)
+
+	if code, _ := get(t, http.DefaultClient, "http://"+addr+"/readyz"); code != http.StatusOK {
+		t.Fatalf("expected ready, got %d", code)
+	}
+	cancel()
+	// ShutdownDelay期间仍然可以处理请求，但是不再就绪
+	time.Sleep(100 * time.Millisecond)
+	if code, _ := get(t, http.DefaultClient, "http://"+addr+"/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected not ready during shutdown, got %d", code)
+	}
+	if err := wait(t, done); err != nil {
+		t.Fatal(err)
+	}
+	if c.Readiness.Ready() {
+		t.Fatal("expected not ready after shutdown")
+	}
+}
+
+func TestServeContextOnStartError(t *testing.T) {
+	errStart := errors.New("start failed")
+	shutdown := false
+	c := &HttpServerConfig{
+		RouterFunc: pingRouter,
+		OnStart:    func(ctx context.Context) error { return errStart },
+		OnShutdown: func(ctx context.Context) error {
+			shutdown = true
+			return nil
+		},
+	}
+	addr, done := start(t, context.Background(), c)
+
+	if err := wait(t, done); !errors.Is(err, errStart) {
+		t.Fatalf("expected start error, got %v", err)
+	}
+	if !shutdown || c.Readiness.Ready() {
+		t.Fatalf("expected the server to be shut down, shutdown: %v, ready: %v", shutdown, c.Readiness.Ready())
+	}
+	if _, err := http.Get("http://" + addr + "/ping"); err == nil {
+		t.Fatal("expected the listener to be closed")
+	}
+}
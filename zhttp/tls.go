@@ -0,0 +1,163 @@
+package zhttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// certCheckInterval 检查证书文件是否修改的间隔
+const certCheckInterval = 10 * time.Second
+
+// TLSConfig Https服务的配置，证书和私钥可以是PEM内容，也可以是文件路径
+type TLSConfig struct {
+	Cert     string // PEM格式的证书
+	Key      string // PEM格式的私钥
+	CertFile string // 证书文件，和KeyFile一起使用，文件修改后自动重新加载
+	KeyFile  string // 私钥文件
+
+	ClientCA     string // PEM格式的客户端CA证书，设置后要求客户端提供由它签发的证书(mTLS)
+	ClientCAFile string // 客户端CA证书文件
+
+	MinVersion   string   // 最低的TLS版本，支持1.0、1.1、1.2、1.3，默认为1.2
+	CipherSuites []string // 允许的加密套件，例如TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256，为空时使用Go的默认值，TLS 1.3不支持设置
+}
+
+// NewTLSConfig 根据c创建tls.Config，不会写入临时文件
+func NewTLSConfig(c *TLSConfig) (*tls.Config, error) {
+	version, err := tlsVersion(c.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	suites, err := cipherSuites(c.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{MinVersion: version, CipherSuites: suites}
+
+	switch {
+	case c.CertFile != "" || c.KeyFile != "":
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, errors.New("tls cert file and key file must be set together")
+		}
+		r := &certReloader{certFile: c.CertFile, keyFile: c.KeyFile, interval: certCheckInterval}
+		if err := r.reload(); err != nil {
+			return nil, err
+		}
+		cfg.GetCertificate = r.GetCertificate
+	case c.Cert != "" || c.Key != "":
+		cert, err := tls.X509KeyPair([]byte(c.Cert), []byte(c.Key))
+		if err != nil {
+			return nil, fmt.Errorf("load tls certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	default:
+		return nil, errors.New("tls certificate is empty")
+	}
+
+	clientCA := []byte(c.ClientCA)
+	if c.ClientCAFile != "" {
+		if clientCA, err = os.ReadFile(c.ClientCAFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(clientCA) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(clientCA) {
+			return nil, errors.New("no valid certificate in tls client CA")
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+func tlsVersion(v string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToUpper(v), "TLS") {
+	case "":
+		return tls.VersionTLS12, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported tls version %q", v)
+	}
+}
+
+// cipherSuites 获取加密套件的ID，不支持不安全的加密套件
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	ids := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		ids[s.Name] = s.ID
+	}
+	suites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := ids[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported or insecure cipher suite %q", name)
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
+
+// certReloader 从文件中加载证书，握手时检查文件是否修改，加载失败时继续使用之前的证书
+type certReloader struct {
+	certFile, keyFile string
+	interval          time.Duration // 检查文件是否修改的间隔
+
+	mu              sync.Mutex
+	cert            *tls.Certificate
+	certMod, keyMod time.Time
+	checked         time.Time
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checked) >= r.interval {
+		if err := r.reload(); err != nil {
+			log.Error("reload tls certificate", zap.Error(err))
+		}
+	}
+	return r.cert, nil
+}
+
+// reload 证书或私钥文件修改时重新加载
+func (r *certReloader) reload() error {
+	r.checked = time.Now()
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return err
+	}
+	if r.cert != nil && certInfo.ModTime().Equal(r.certMod) && keyInfo.ModTime().Equal(r.keyMod) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load tls certificate: %w", err)
+	}
+	r.cert, r.certMod, r.keyMod = &cert, certInfo.ModTime(), keyInfo.ModTime()
+	log.Info("tls certificate loaded: ", r.certFile)
+	return nil
+}
@@ -0,0 +1,240 @@
+package zhttp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA 测试用的CA，在内存中生成
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	ca := &testCA{}
+	ca.cert, ca.key, ca.pem = issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	return ca
+}
+
+// issue 签发localhost的服务端和客户端证书，返回PEM格式的证书和私钥
+func (ca *testCA) issue(t *testing.T, name string) (certPEM, keyPEM string) {
+	t.Helper()
+	_, key, certPEM := issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}, ca)
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certPEM, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+}
+
+// issue 使用parent签发证书，parent为nil时自签名
+func issue(t *testing.T, tpl *x509.Certificate, parent *testCA) (*x509.Certificate, *ecdsa.PrivateKey, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl.SerialNumber = serial
+	tpl.NotBefore = time.Now().Add(-time.Minute)
+	tpl.NotAfter = time.Now().Add(time.Hour)
+
+	parentCert, parentKey := tpl, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// client 信任ca的Https客户端，certPEM不为空时使用客户端证书
+func (ca *testCA) client(t *testing.T, certPEM, keyPEM string) *http.Client {
+	t.Helper()
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	cfg := &tls.Config{RootCAs: pool}
+	if certPEM != "" {
+		cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg, DisableKeepAlives: true}}
+}
+
+func TestServeTLS(t *testing.T) {
+	ca := newTestCA(t)
+	cert, key := ca.issue(t, "server")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, done := start(t, ctx, &HttpServerConfig{Https: true, Cert: cert, Key: key, RouterFunc: pingRouter})
+
+	if code, body := get(t, ca.client(t, "", ""), "https://"+addr+"/ping"); code != http.StatusOK || body != "pong" {
+		t.Fatalf("unexpected response %d %q", code, body)
+	}
+	cancel()
+	if err := wait(t, done); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	cert, key := ca.issue(t, "server")
+	clientCert, clientKey := ca.issue(t, "client")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, done := start(t, ctx, &HttpServerConfig{
+		TLS:        &TLSConfig{Cert: cert, Key: key, ClientCA: ca.pem, MinVersion: "1.2"},
+		RouterFunc: pingRouter,
+	})
+
+	if code, _ := get(t, ca.client(t, clientCert, clientKey), "https://"+addr+"/ping"); code != http.StatusOK {
+		t.Fatalf("expected ok with client cert, got %d", code)
+	}
+	if _, err := ca.client(t, "", "").Get("https://" + addr + "/ping"); err == nil {
+		t.Fatal("expected handshake error without client cert")
+	}
+	cancel()
+	if err := wait(t, done); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	ca := newTestCA(t)
+	cert, key := ca.issue(t, "server")
+
+	cfg, err := NewTLSConfig(&TLSConfig{
+		Cert:         cert,
+		Key:          key,
+		MinVersion:   "TLS1.3",
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinVersion != tls.VersionTLS13 || len(cfg.CipherSuites) != 1 ||
+		cfg.CipherSuites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 || cfg.ClientAuth != tls.NoClientCert {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	invalid := map[string]*TLSConfig{
+		"version":         {Cert: cert, Key: key, MinVersion: "1.4"},
+		"suite":           {Cert: cert, Key: key, CipherSuites: []string{"TLS_NOPE"}},
+		"insecure suite":  {Cert: cert, Key: key, CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		"empty":           {},
+		"key file":        {CertFile: "cert.pem"},
+		"client CA":       {Cert: cert, Key: key, ClientCA: "not a cert"},
+		"mismatched cert": {Cert: cert, Key: key[:len(key)/2]},
+	}
+	for name, c := range invalid {
+		if _, err := NewTLSConfig(c); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestCertReload(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	write := func(name string, modTime time.Time) {
+		cert, key := ca.issue(t, name)
+		for file, data := range map[string]string{certFile: cert, keyFile: key} {
+			if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(file, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	commonName := func(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) string {
+		cert, err := getCertificate(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.Subject.CommonName
+	}
+
+	now := time.Now()
+	write("first", now)
+	cfg, err := NewTLSConfig(&TLSConfig{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := commonName(cfg.GetCertificate); name != "first" {
+		t.Fatalf("expected first, got %s", name)
+	}
+
+	r := &certReloader{certFile: certFile, keyFile: keyFile, interval: time.Hour}
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 间隔内不会重新加载
+	write("second", now.Add(time.Minute))
+	if name := commonName(r.GetCertificate); name != "first" {
+		t.Fatalf("expected first before the check interval, got %s", name)
+	}
+	r.interval = 0
+	if name := commonName(r.GetCertificate); name != "second" {
+		t.Fatalf("expected second after the check interval, got %s", name)
+	}
+
+	// 加载失败时继续使用之前的证书
+	if err := os.WriteFile(keyFile, []byte("broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(keyFile, now.Add(2*time.Minute), now.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if name := commonName(r.GetCertificate); name != "second" {
+		t.Fatalf("expected second after a broken update, got %s", name)
+	}
+}
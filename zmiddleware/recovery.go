@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	"github.com/gin-gonic/gin"
+	"github.com/zzjcool/goutils/ferr"
 	"github.com/zzjcool/goutils/zhttp"
 	"go.uber.org/zap"
 )
@@ -11,12 +12,14 @@ import (
 // 宕机恢复中间件
 func RecoveryMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		var err error
 		defer func() {
-			if err := recover(); err != nil {
-				zap.L().Error("panic recovered", zap.Any("error", err))
-				zhttp.Result(c, err, errors.New("server panic"))
+			if err != nil {
+				zap.L().Error("panic recovered", zap.Error(err), zap.String("stack", ferr.Convert(err).Stack()))
+				zhttp.Result(c, err.Error(), errors.New("server panic"))
 			}
 		}()
+		defer ferr.Recover(&err)
 		c.Next()
 	}
 }